@@ -0,0 +1,15 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaeaddrinuse is WSAEADDRINUSE. Winsock returns it for a taken address,
+// and it doesn't match syscall.EADDRINUSE, which Windows only emulates.
+const wsaeaddrinuse = syscall.Errno(10048)
+
+// isAddrInUse reports whether err means the listen address is already taken.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeaddrinuse) || errors.Is(err, syscall.EADDRINUSE)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// valueKind is the JSON type an answer value is written as. Values are kept
+// as strings internally; the kind only affects encoding.
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindList
+	kindBool
+)
+
+// UnmarshalJSON accepts the value as a string, number, boolean, array of
+// strings or null, so clients don't have to stringify typed answers. The
+// value is stored as its string form: 42 as "42", true as "true" and
+// ["a","b"] as the JSON text of the array, as older clients send it.
+func (a *Answer) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		QuestionID int             `json:"questionId"`
+		Value      json.RawMessage `json:"value"`
+	}
+	// A custom unmarshaler doesn't inherit DisallowUnknownFields from the
+	// request decoder, so unknown fields are rejected here as well.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	value, kind, err := decodeAnswerValue(raw.Value)
+	if err != nil {
+		return err
+	}
+	*a = Answer{QuestionID: raw.QuestionID, Value: value, kind: kind}
+	return nil
+}
+
+var errInvalidAnswerValue = errors.New("answer value must be a string, number, boolean or array of strings")
+
+func decodeAnswerValue(data json.RawMessage) (string, valueKind, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		return "", kindString, nil
+	}
+	switch data[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(data, &s)
+		return s, kindString, err
+	case 't', 'f':
+		var b bool
+		if err := json.Unmarshal(data, &b); err != nil {
+			return "", kindString, err
+		}
+		return strconv.FormatBool(b), kindBool, nil
+	case '[':
+		var items []string
+		if err := json.Unmarshal(data, &items); err != nil {
+			return "", kindString, errInvalidAnswerValue
+		}
+		encoded, err := json.Marshal(items)
+		return string(encoded), kindList, err
+	case '{':
+		return "", kindString, errInvalidAnswerValue
+	default:
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return "", kindString, err
+		}
+		return n.String(), kindNumber, nil
+	}
+}
+
+// MarshalJSON writes numbers, multiselect answers and answers sent as booleans
+// with their native JSON type and everything else as a string.
+func (a Answer) MarshalJSON() ([]byte, error) {
+	value := json.RawMessage(nil)
+	switch {
+	case a.kind == kindNumber && isJSONNumber(a.Value):
+		value = json.RawMessage(a.Value)
+	case a.kind == kindList && json.Valid([]byte(a.Value)) && strings.HasPrefix(a.Value, "["):
+		value = json.RawMessage(a.Value)
+	case a.kind == kindBool && (a.Value == "true" || a.Value == "false"):
+		value = json.RawMessage(a.Value)
+	default:
+		encoded, err := json.Marshal(a.Value)
+		if err != nil {
+			return nil, err
+		}
+		value = encoded
+	}
+	return json.Marshal(struct {
+		QuestionID int             `json:"questionId"`
+		Value      json.RawMessage `json:"value"`
+	}{a.QuestionID, value})
+}
+
+func isJSONNumber(s string) bool {
+	var f float64
+	return s != "" && s[0] != '"' && json.Unmarshal([]byte(s), &f) == nil
+}
+
+// kindFor returns how answers to q are encoded.
+func kindFor(q Question) valueKind {
+	switch q.Type {
+	case "number", "rating":
+		return kindNumber
+	case "multiselect":
+		return kindList
+	}
+	return kindString
+}
+
+// answerKind returns how an answer to q decoded as decoded is encoded. No
+// question type is boolean, so a boolean keeps its kind wherever answers are
+// strings anyway.
+func answerKind(q Question, decoded valueKind) valueKind {
+	kind := kindFor(q)
+	if kind == kindString && decoded == kindBool {
+		return kindBool
+	}
+	return kind
+}
+
+// setAnswerKinds sets the encoding of answers from the types of their
+// questions, for example after loading a file written when all values were
+// strings.
+func setAnswerKinds(byID map[int]Question, answers []Answer) {
+	for i, a := range answers {
+		answers[i].kind = answerKind(byID[a.QuestionID], a.kind)
+	}
+}
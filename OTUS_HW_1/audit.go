@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Audit actions, one per kind of change to stored answers.
+const (
+	auditCreate  = "create"
+	auditUpdate  = "update"
+	auditDelete  = "delete"
+	auditUpload  = "upload"
+	auditImport  = "import"
+	auditRestore = "restore"
+	auditReset   = "reset"
+)
+
+type auditEntry struct {
+	At           time.Time `json:"at"`
+	Survey       string    `json:"survey"`
+	Action       string    `json:"action"`
+	SubmissionID int       `json:"submissionId,omitempty"`
+	RequestID    string    `json:"requestId"`
+	Client       string    `json:"client"`
+	// QuestionIDs lists the questions answered by create, update, import and
+	// upload. The values themselves are left out, so deleting a submission
+	// removes them for good.
+	QuestionIDs []int  `json:"questionIds,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// auditLog is an append-only record of every change to stored answers. It is
+// kept apart from the answer stores and entries are never modified. With a
+// file, every entry is also appended to it as a line of JSON.
+type auditLog struct {
+	mu      sync.RWMutex
+	entries []auditEntry
+	file    *os.File
+}
+
+// newAuditLog loads the entries already in the file at path and opens it for
+// appending. An empty path keeps the log in memory only.
+func newAuditLog(path string) (*auditLog, error) {
+	a := &auditLog{entries: make([]auditEntry, 0)}
+	if path == "" {
+		return a, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open audit file: %w", err)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("parse audit file %s line %d: %w", path, line, err)
+		}
+		a.entries = append(a.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read audit file: %w", err)
+	}
+	a.file = f
+	return a, nil
+}
+
+func (a *auditLog) append(e auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+	if a.file == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err == nil {
+		_, err = a.file.Write(append(line, '\n'))
+	}
+	// The change itself already happened, so a failed write is only logged.
+	if err != nil {
+		slog.Error("write audit entry", "request_id", e.RequestID, "error", err)
+	}
+}
+
+// page returns up to limit entries of survey starting at offset, oldest first
+// unless desc is set, together with the number of entries for survey.
+func (a *auditLog) page(survey string, offset, limit int, desc bool) ([]auditEntry, int) {
+	a.mu.RLock()
+	matched := make([]auditEntry, 0)
+	for _, e := range a.entries {
+		if e.Survey == survey {
+			matched = append(matched, e)
+		}
+	}
+	a.mu.RUnlock()
+
+	if desc {
+		slices.Reverse(matched)
+	}
+	total := len(matched)
+	if offset >= total {
+		return []auditEntry{}, total
+	}
+	return matched[offset:min(offset+limit, total)], total
+}
+
+func (a *auditLog) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil {
+		if err := a.file.Close(); err != nil {
+			slog.Error("close audit file", "error", err)
+		}
+		a.file = nil
+	}
+}
+
+// auditTrail records changes to the answers of one survey.
+type auditTrail struct {
+	log    *auditLog
+	survey string
+}
+
+func (t auditTrail) record(r *http.Request, action string, submissionID int, answers []Answer, detail string) {
+	var questionIDs []int
+	for _, a := range answers {
+		if a.Value != "" && !slices.Contains(questionIDs, a.QuestionID) {
+			questionIDs = append(questionIDs, a.QuestionID)
+		}
+	}
+	t.log.append(auditEntry{
+		At:           time.Now().UTC(),
+		Survey:       t.survey,
+		Action:       action,
+		SubmissionID: submissionID,
+		RequestID:    requestID(r.Context()),
+		Client:       clientIP(r),
+		QuestionIDs:  questionIDs,
+		Detail:       detail,
+	})
+}
+
+type auditPage struct {
+	Entries []auditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+func auditHandler(trail auditTrail) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit, err := parseNonNegativeInt(query.Get("limit"), defaultPageLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		offset, err := parseNonNegativeInt(query.Get("offset"), 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		limit = min(limit, maxPageLimit)
+		sortOrder := query.Get("sort")
+		if sortOrder != "" && sortOrder != "asc" && sortOrder != "desc" {
+			writeError(w, http.StatusBadRequest, "sort must be asc or desc")
+			return
+		}
+
+		entries, total := trail.log.page(trail.survey, offset, limit, sortOrder == "desc")
+		writeJSON(w, http.StatusOK, auditPage{Entries: entries, Total: total, Limit: limit, Offset: offset})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// backupVersion is bumped whenever the backup document changes shape.
+const backupVersion = 1
+
+// backupDocument holds the complete state of a survey.
+type backupDocument struct {
+	Version     int                `json:"version"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	Questions   []Question         `json:"questions"`
+	Submissions []StoredSubmission `json:"submissions"`
+}
+
+func backupHandler(qs *questionSet, store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc := backupDocument{
+			Version:     backupVersion,
+			CreatedAt:   time.Now().UTC(),
+			Questions:   qs.all(),
+			Submissions: store.snapshot(),
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="backup.json"`)
+		writeJSON(w, http.StatusOK, doc)
+	}
+}
+
+// resetHandler deletes every submission of the survey together with their
+// uploaded files. It is meant for test setups and refuses to run unless the
+// server was started with -allow-reset.
+func resetHandler(qs *questionSet, store *answerStore, trail auditTrail, uploadsDir string, allowed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowed {
+			writeError(w, http.StatusForbidden, "reset is disabled; start the server with -allow-reset to enable it")
+			return
+		}
+		deleted, err := store.reset()
+		if err != nil {
+			slog.Error("reset answers", "request_id", requestID(r.Context()), "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to reset submissions")
+			return
+		}
+		for _, sub := range deleted {
+			removeUploads(qs, uploadsDir, sub)
+		}
+		slog.Info("answers reset", "request_id", requestID(r.Context()), "deleted", len(deleted))
+		trail.record(r, auditReset, 0, nil, fmt.Sprintf("deleted %d submissions", len(deleted)))
+		writeJSON(w, http.StatusOK, map[string]int{"deleted": len(deleted)})
+	}
+}
+
+// restoreHandler replaces questions and submissions with a backup document.
+// Nothing changes unless the whole document is valid.
+func restoreHandler(qs *questionSet, store *answerStore, trail auditTrail) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var doc backupDocument
+		if !decodeJSONBody(w, r, importMaxBodySize, &doc) {
+			return
+		}
+		if doc.Version != backupVersion {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported backup version %d", doc.Version))
+			return
+		}
+		if len(doc.Questions) == 0 {
+			writeError(w, http.StatusBadRequest, "backup contains no questions")
+			return
+		}
+		// Validating into a throwaway set catches every problem replace
+		// would report, before anything is touched.
+		restored, err := newQuestionSet(doc.Questions)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := validateBackupSubmissions(doc); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		byID := restored.snapshot().byID
+		for _, sub := range doc.Submissions {
+			setAnswerKinds(byID, sub.Answers)
+		}
+
+		if err := store.replaceAll(doc.Submissions); err != nil {
+			slog.Error("restore answers", "request_id", requestID(r.Context()), "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to restore submissions")
+			return
+		}
+		if err := qs.replace(doc.Questions); err != nil {
+			// The same list passed validation above.
+			slog.Error("restore questions", "request_id", requestID(r.Context()), "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to restore questions")
+			return
+		}
+		slog.Info("backup restored", "request_id", requestID(r.Context()), "questions", len(doc.Questions), "submissions", len(doc.Submissions))
+		trail.record(r, auditRestore, 0, nil, fmt.Sprintf("replaced all submissions with %d from a backup", len(doc.Submissions)))
+		writeJSON(w, http.StatusOK, map[string]int{"questions": len(doc.Questions), "submissions": len(doc.Submissions)})
+	}
+}
+
+func validateBackupSubmissions(doc backupDocument) error {
+	questions := make(map[int]bool, len(doc.Questions))
+	for _, q := range doc.Questions {
+		questions[q.ID] = true
+	}
+
+	seen := make(map[int]bool, len(doc.Submissions))
+	for _, sub := range doc.Submissions {
+		if sub.ID <= 0 {
+			return errors.New("submission ids must be positive integers")
+		}
+		if seen[sub.ID] {
+			return fmt.Errorf("submission %d: duplicate id", sub.ID)
+		}
+		seen[sub.ID] = true
+
+		if sub.Status != statusDraft && sub.Status != statusFinal {
+			return fmt.Errorf("submission %d: status must be draft or final", sub.ID)
+		}
+		if sub.SubmittedAt.IsZero() {
+			return fmt.Errorf("submission %d: submittedAt is required", sub.ID)
+		}
+		for _, a := range sub.Answers {
+			if !questions[a.QuestionID] {
+				return fmt.Errorf("submission %d: answer to unknown question %d", sub.ID, a.QuestionID)
+			}
+		}
+	}
+	return nil
+}
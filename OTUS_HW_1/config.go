@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type config struct {
+	Addr                string
+	StaticDir           string
+	AnswersFile         string
+	QuestionsFile       string
+	MaxBodySize         int64
+	CORSOrigins         []string
+	CORSCredentials     bool
+	AdminUser           string
+	AdminPass           string
+	WebhookURL          string
+	RateLimit           int
+	RateBurst           int
+	TrustProxy          bool
+	RequestTimeout      time.Duration
+	TLSCert             string
+	TLSKey              string
+	UploadsDir          string
+	DedupWindow         time.Duration
+	SurveysDir          string
+	SurveyAnswersDir    string
+	TrustedProxies      []netip.Prefix
+	DefaultLocale       string
+	MaxAnswers          int
+	IdempotencyTTL      time.Duration
+	SPAMode             bool
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+	AuditFile           string
+	CaptureMetadata     bool
+	AllowReset          bool
+	MaxSubmissionsPerIP int
+	LogLevel            slog.Level
+	LogFormat           string
+}
+
+// loadConfig reads settings from command-line flags. Every flag falls back to
+// an environment variable, and then to the built-in default.
+func loadConfig() config {
+	var cfg config
+	flag.StringVar(&cfg.Addr, "addr", envOrDefault("ADDR", ":8080"), "HTTP listen address")
+	flag.StringVar(&cfg.StaticDir, "static-dir", envOrDefault("STATIC_DIR", "./static"), "directory with frontend files")
+	flag.BoolVar(&cfg.SPAMode, "spa-mode", envBoolOrDefault("SPA_MODE", false), "serve index.html for unknown paths without a file extension (single-page app fallback)")
+	flag.StringVar(&cfg.AnswersFile, "answers-file", envOrDefault("ANSWERS_FILE", ""), "path to the JSON file for persisting answers (empty keeps them in memory)")
+	flag.StringVar(&cfg.QuestionsFile, "questions-file", envOrDefault("QUESTIONS_FILE", ""), "path to a JSON file with survey questions (empty uses the built-in set)")
+	flag.StringVar(&cfg.AuditFile, "audit-file", envOrDefault("AUDIT_FILE", ""), "path to the append-only JSON lines file of the audit log (empty keeps it in memory)")
+	flag.StringVar(&cfg.SurveysDir, "surveys-dir", envOrDefault("SURVEYS_DIR", ""), "directory with additional surveys, one <id>.json question file each")
+	flag.StringVar(&cfg.SurveyAnswersDir, "survey-answers-dir", envOrDefault("SURVEY_ANSWERS_DIR", ""), "directory for persisting answers of additional surveys (empty keeps them in memory)")
+	flag.StringVar(&cfg.DefaultLocale, "default-locale", envOrDefault("DEFAULT_LOCALE", "ru"), "locale of question text when Accept-Language matches none of the translations")
+	flag.StringVar(&cfg.UploadsDir, "uploads-dir", envOrDefault("UPLOADS_DIR", "./uploads"), "directory for files uploaded to file questions")
+	flag.Int64Var(&cfg.MaxBodySize, "max-body-size", envInt64OrDefault("MAX_BODY_SIZE", 1<<20), "maximum size of a POST /answers body in bytes")
+	flag.IntVar(&cfg.MaxAnswers, "max-answers", int(envInt64OrDefault("MAX_ANSWERS", 0)), "maximum number of answers in one submission (0 allows the question count plus 10)")
+	corsOrigin := flag.String("cors-origin", envOrDefault("CORS_ORIGIN", "*"), "comma-separated origins allowed to make cross-origin requests, or * for any")
+	flag.BoolVar(&cfg.CORSCredentials, "cors-credentials", envBoolOrDefault("CORS_CREDENTIALS", false), "send Access-Control-Allow-Credentials so browsers include credentials in cross-origin requests")
+	flag.StringVar(&cfg.WebhookURL, "webhook-url", envOrDefault("WEBHOOK_URL", ""), "URL that receives every new submission as JSON (empty disables webhooks)")
+	flag.IntVar(&cfg.RateLimit, "rate-limit", int(envInt64OrDefault("RATE_LIMIT", 30)), "POST /answers requests allowed per client IP per minute (0 disables the limit)")
+	flag.IntVar(&cfg.RateBurst, "rate-burst", int(envInt64OrDefault("RATE_BURST", 5)), "POST /answers requests a client IP may send in a burst")
+	flag.BoolVar(&cfg.TrustProxy, "trust-proxy", envBoolOrDefault("TRUST_PROXY", false), "take the client IP from X-Forwarded-For or X-Real-IP (enable only behind a reverse proxy)")
+	trustedProxies := flag.String("trusted-proxies", envOrDefault("TRUSTED_PROXIES", defaultTrustedProxies), "comma-separated CIDR networks of reverse proxies whose forwarding headers are honoured")
+	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", envDurationOrDefault("REQUEST_TIMEOUT", 30*time.Second), "deadline for handling a single request (0 disables it)")
+	flag.DurationVar(&cfg.ReadTimeout, "read-timeout", envDurationOrDefault("READ_TIMEOUT", 15*time.Second), "maximum time to read a request, including the body (0 disables it)")
+	flag.DurationVar(&cfg.WriteTimeout, "write-timeout", envDurationOrDefault("WRITE_TIMEOUT", 60*time.Second), "maximum time from the end of the request headers to the end of the response (0 disables it)")
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", envDurationOrDefault("IDLE_TIMEOUT", 120*time.Second), "how long an idle keep-alive connection stays open (0 uses the read timeout)")
+	flag.IntVar(&cfg.MaxSubmissionsPerIP, "max-submissions-per-ip", int(envInt64OrDefault("MAX_SUBMISSIONS_PER_IP", 0)), "total POST /answers submissions accepted from one client IP, edits excluded (0 disables the cap)")
+	flag.DurationVar(&cfg.DedupWindow, "dedup-window", envDurationOrDefault("DEDUP_WINDOW", 0), "reject POST /answers identical to a submission stored within this period (0 disables the check)")
+	flag.BoolVar(&cfg.CaptureMetadata, "capture-metadata", envBoolOrDefault("CAPTURE_METADATA", true), "store the User-Agent and Referer of each submission (disable where this data must not be kept)")
+	flag.DurationVar(&cfg.IdempotencyTTL, "idempotency-ttl", envDurationOrDefault("IDEMPOTENCY_TTL", 24*time.Hour), "how long an Idempotency-Key on POST /answers is remembered (0 ignores the header)")
+	flag.BoolVar(&cfg.AllowReset, "allow-reset", envBoolOrDefault("ALLOW_RESET", false), "enable POST /admin/reset, which deletes all submissions (for tests, never in production)")
+	logLevel := flag.String("log-level", envOrDefault("LOG_LEVEL", "info"), "minimum level of logged messages: debug, info, warn or error")
+	flag.StringVar(&cfg.LogFormat, "log-format", envOrDefault("LOG_FORMAT", logFormatText), "log output format: text (key=value) or json (one object per line)")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", envOrDefault("TLS_CERT", ""), "path to the TLS certificate (enables HTTPS together with -tls-key)")
+	flag.StringVar(&cfg.TLSKey, "tls-key", envOrDefault("TLS_KEY", ""), "path to the TLS private key (enables HTTPS together with -tls-cert)")
+	flag.Parse()
+
+	// The logger is set up first, so the checks below already report in the
+	// configured format.
+	if err := cfg.LogLevel.UnmarshalText([]byte(*logLevel)); err != nil {
+		fatal("invalid -log-level", "error", err)
+	}
+	if cfg.LogFormat != logFormatText && cfg.LogFormat != logFormatJSON {
+		fatal("invalid -log-format, expected text or json", "format", cfg.LogFormat)
+	}
+	slog.SetDefault(newLogger(os.Stderr, cfg.LogLevel, cfg.LogFormat))
+
+	var err error
+	if cfg.TrustedProxies, err = parsePrefixes(*trustedProxies); err != nil {
+		fatal("invalid -trusted-proxies", "error", err)
+	}
+
+	cfg.CORSOrigins = parseOrigins(*corsOrigin)
+	if cfg.CORSCredentials && slices.Contains(cfg.CORSOrigins, "*") {
+		fatal("-cors-credentials requires -cors-origin to list origins instead of *")
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		fatal("both -tls-cert and -tls-key must be set to enable HTTPS")
+	}
+
+	// Credentials are read from the environment only so they don't show up
+	// in the process list.
+	cfg.AdminUser = os.Getenv("ADMIN_USER")
+	cfg.AdminPass = os.Getenv("ADMIN_PASS")
+	return cfg
+}
+
+func envOrDefault(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func envInt64OrDefault(key string, fallback int64) int64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		fatal("invalid environment variable", "key", key, "error", err)
+	}
+	return n
+}
+
+func envBoolOrDefault(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		fatal("invalid environment variable", "key", key, "error", err)
+	}
+	return b
+}
+
+func envDurationOrDefault(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fatal("invalid environment variable", "key", key, "error", err)
+	}
+	return d
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushRows is how many rows are written between flushes. The header is
+// flushed right away, so a large export starts downloading at once instead of
+// after the last row.
+const exportFlushRows = 100
+
+// isExport reports whether r downloads an export. Exports can take longer
+// than REQUEST_TIMEOUT on big datasets, so they are exempt from it.
+func isExport(r *http.Request) bool {
+	return r.Method == http.MethodGet && (strings.HasSuffix(r.URL.Path, "/answers/export.csv") || strings.HasSuffix(r.URL.Path, "/answers/export.jsonl"))
+}
+
+func exportCSVHandler(qs *questionSet, store *answerStore, defaultLocale string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subs, err := finalSubmissions(r, store)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bom, err := parseBoolParam(r, "bom")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		questions := requestQuestions(r, qs, defaultLocale)
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="answers.csv"`)
+
+		// Excel reads a CSV as UTF-8 only when it starts with a byte order mark.
+		if bom {
+			if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+				slog.Error("write export", "request_id", requestID(r.Context()), "format", "csv", "error", err)
+				return
+			}
+		}
+		cw := csv.NewWriter(w)
+
+		header := []string{"id", "submittedAt"}
+		for _, q := range questions {
+			header = append(header, q.Text.String())
+		}
+		header = append(header, "userAgent", "referer")
+		if err := cw.Write(header); err != nil {
+			slog.Error("write export", "request_id", requestID(r.Context()), "format", "csv", "error", err)
+			return
+		}
+
+		flush := func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		writeRows(w, r, "csv", subs, flush, func(sub StoredSubmission) error {
+			values := make(map[int]string, len(sub.Answers))
+			for _, a := range sub.Answers {
+				values[a.QuestionID] = a.Value
+			}
+
+			row := []string{strconv.Itoa(sub.ID), sub.SubmittedAt.Format(time.RFC3339)}
+			for _, q := range questions {
+				row = append(row, values[q.ID])
+			}
+			row = append(row, sub.UserAgent, sub.Referer)
+			return cw.Write(row)
+		})
+	}
+}
+
+// exportJSONLHandler writes one submission per line as newline-delimited
+// JSON, in the format of GET /answers/{id}.
+func exportJSONLHandler(store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subs, err := finalSubmissions(r, store)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="answers.jsonl"`)
+
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		writeRows(w, r, "jsonl", subs, bw.Flush, func(sub StoredSubmission) error {
+			return enc.Encode(sub)
+		})
+	}
+}
+
+// writeRows writes subs with write, calling flush and flushing the response
+// every exportFlushRows rows and once at the end. It stops when the client
+// goes away; format names the export in the log.
+func writeRows(w http.ResponseWriter, r *http.Request, format string, subs []StoredSubmission, flush func() error, write func(StoredSubmission) error) {
+	rc := http.NewResponseController(w)
+	// A large export to a slow client may outlast the server's WriteTimeout,
+	// which would cut the file off in the middle.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("export: clear write deadline", "request_id", requestID(r.Context()), "format", format, "error", err)
+	}
+	for i, sub := range subs {
+		if i%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				slog.Error("write export", "request_id", requestID(r.Context()), "format", format, "error", err)
+				return
+			}
+			// Responses that can't be flushed are simply sent at the end.
+			_ = rc.Flush()
+		}
+		if err := r.Context().Err(); err != nil {
+			slog.Warn("export stopped", "request_id", requestID(r.Context()), "format", format, "error", err)
+			return
+		}
+		if err := write(sub); err != nil {
+			slog.Error("write export", "request_id", requestID(r.Context()), "format", format, "error", err)
+			return
+		}
+	}
+
+	if err := flush(); err != nil {
+		slog.Error("write export", "request_id", requestID(r.Context()), "format", format, "error", err)
+	}
+}
@@ -0,0 +1,771 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func healthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+func readyHandler(surveys []*Survey) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range surveys {
+			if err := s.store.checkWritable(); err != nil {
+				slog.Warn("readiness check failed", "survey", s.ID, "error", err)
+				writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "error": err.Error()})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+func questionsHandler(qs *questionSet, defaultLocale string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := requestQuestions(r, qs, defaultLocale)
+		w.Header().Add("Vary", "Accept-Language")
+		if notModified(w, r, computeETag(list)) {
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func groupedQuestionsHandler(qs *questionSet, defaultLocale string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := requestQuestions(r, qs, defaultLocale)
+		w.Header().Add("Vary", "Accept-Language")
+		if notModified(w, r, computeETag(list)) {
+			return
+		}
+		writeJSON(w, http.StatusOK, groupBySection(list))
+	}
+}
+
+// requestQuestions returns the questions sorted by order and localized for
+// the Accept-Language of r.
+func requestQuestions(r *http.Request, qs *questionSet, defaultLocale string) []Question {
+	list := qs.all()
+	sortByOrder(list)
+	return localizeQuestions(list, parseAcceptLanguage(r.Header.Get("Accept-Language")), defaultLocale)
+}
+
+// notModified sets the ETag header and, when the client already has this
+// version, answers 304 and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison required for GET requests.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func createQuestionHandler(qs *questionSet, maxBodySize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q Question
+		if !decodeJSONBody(w, r, maxBodySize, &q) {
+			return
+		}
+
+		created, err := qs.add(q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Info("question added", "request_id", requestID(r.Context()), "question_id", created.ID)
+		writeJSON(w, http.StatusCreated, created)
+	}
+}
+
+// updateQuestionHandler replaces a question. If stored answers would no longer
+// pass validation under the new definition, for example after a type change,
+// the request is refused with 409 unless it carries ?force=true.
+func updateQuestionHandler(qs *questionSet, store *answerStore, maxBodySize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid question id")
+			return
+		}
+		force, err := parseBoolParam(r, "force")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		existing, ok := qs.find(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "question not found")
+			return
+		}
+
+		var q Question
+		if !decodeJSONBody(w, r, maxBodySize, &q) {
+			return
+		}
+		if q.ID != 0 && q.ID != id {
+			writeError(w, http.StatusBadRequest, "question id in the body does not match the URL")
+			return
+		}
+		q.ID = id
+
+		patterns, err := compilePatterns([]Question{q})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		invalid := invalidatedAnswers(existing, q, patterns[id], store.snapshot())
+		if invalid > 0 && !force {
+			writeError(w, http.StatusConflict, fmt.Sprintf("%d stored answers would no longer be valid; repeat with ?force=true to apply the change anyway", invalid))
+			return
+		}
+
+		found, err := qs.update(q)
+		if !found {
+			writeError(w, http.StatusNotFound, "question not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		store.setAnswerKinds(qs.snapshot().byID)
+		if invalid > 0 {
+			slog.Warn("question updated with force", "request_id", requestID(r.Context()), "question_id", id, "invalid_answers", invalid)
+		} else {
+			slog.Info("question updated", "request_id", requestID(r.Context()), "question_id", id)
+		}
+		writeJSON(w, http.StatusOK, q)
+	}
+}
+
+// invalidatedAnswers counts the stored answers to old that would fail
+// validation as answers to updated.
+func invalidatedAnswers(old, updated Question, pattern *regexp.Regexp, subs []StoredSubmission) int {
+	// File answers hold upload names, which validateValue never accepts.
+	if old.Type == "file" && updated.Type == "file" {
+		return 0
+	}
+	invalid := 0
+	for _, sub := range subs {
+		for _, a := range sub.Answers {
+			if a.QuestionID == old.ID && a.Value != "" && validateValue(updated, pattern, a.Value) != nil {
+				invalid++
+			}
+		}
+	}
+	return invalid
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// scoredSubmission adds the total score to a listed submission when the
+// survey has scored questions.
+type scoredSubmission struct {
+	StoredSubmission
+	Score *float64 `json:"score,omitempty"`
+}
+
+type answersPage struct {
+	Submissions []scoredSubmission `json:"submissions"`
+	Total       int                `json:"total"`
+	Limit       int                `json:"limit"`
+	Offset      int                `json:"offset"`
+	// NextCursor is set in cursor mode (?after=) while more submissions
+	// follow; passing it as after fetches the next page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+func listAnswersHandler(qs *questionSet, store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit, err := parseNonNegativeInt(query.Get("limit"), defaultPageLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		offset, err := parseNonNegativeInt(query.Get("offset"), 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		limit = min(limit, maxPageLimit)
+
+		sortOrder := query.Get("sort")
+		if sortOrder != "" && sortOrder != "asc" && sortOrder != "desc" {
+			writeError(w, http.StatusBadRequest, "sort must be asc or desc")
+			return
+		}
+
+		// A cursor is the ID of the last submission on the previous page, so
+		// pages don't shift while new submissions arrive. 0 starts from the
+		// beginning.
+		cursorMode := query.Has("after")
+		after, err := parseNonNegativeInt(query.Get("after"), 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "after must be a cursor returned in nextCursor")
+			return
+		}
+		if cursorMode && query.Has("offset") {
+			writeError(w, http.StatusBadRequest, "after and offset can't be combined")
+			return
+		}
+
+		match, err := answerFilter(qs, query)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		includeDrafts, err := parseBoolParam(r, "includeDrafts")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !includeDrafts {
+			match = withoutDrafts(match)
+		}
+
+		var subs []StoredSubmission
+		var total int
+		var nextCursor string
+		if cursorMode {
+			var more bool
+			subs, total, more = store.pageAfter(after, limit, sortOrder == "desc", match)
+			if more && len(subs) > 0 {
+				nextCursor = strconv.Itoa(subs[len(subs)-1].ID)
+			}
+		} else {
+			subs, total = store.page(offset, limit, sortOrder == "desc", match)
+		}
+		list := qs.all()
+		scored := make([]scoredSubmission, len(subs))
+		for i, sub := range subs {
+			scored[i].StoredSubmission = sub
+			if score, ok := scoreSubmission(list, sub); ok {
+				scored[i].Score = &score.Total
+			}
+		}
+		writeJSON(w, http.StatusOK, answersPage{Submissions: scored, Total: total, Limit: limit, Offset: offset, NextCursor: nextCursor})
+	}
+}
+
+// answerFilter builds the submission filter described by the questionId, value
+// and match query parameters. It returns nil when no filter is requested.
+func answerFilter(qs *questionSet, query url.Values) (func(StoredSubmission) bool, error) {
+	rawID, value, mode := query.Get("questionId"), query.Get("value"), query.Get("match")
+	if rawID == "" {
+		if value != "" || mode != "" {
+			return nil, errors.New("value and match require questionId")
+		}
+		return nil, nil
+	}
+
+	questionID, err := strconv.Atoi(rawID)
+	if err != nil {
+		return nil, errors.New("questionId must be an integer")
+	}
+	if _, ok := qs.find(questionID); !ok {
+		return nil, fmt.Errorf("unknown question %d", questionID)
+	}
+
+	var matches func(string) bool
+	switch mode {
+	case "", "exact":
+		matches = func(v string) bool { return value == "" || v == value }
+	case "contains":
+		needle := strings.ToLower(value)
+		matches = func(v string) bool { return strings.Contains(strings.ToLower(v), needle) }
+	default:
+		return nil, errors.New("match must be exact or contains")
+	}
+
+	return func(sub StoredSubmission) bool {
+		return slices.ContainsFunc(sub.Answers, func(a Answer) bool {
+			return a.QuestionID == questionID && a.Value != "" && matches(a.Value)
+		})
+	}, nil
+}
+
+// countAnswersHandler reports the number of final submissions without
+// copying them, for dashboards that poll frequently. Like the total of GET
+// /answers it leaves drafts out unless includeDrafts is set, so a dashboard
+// doesn't take saved drafts for new responses.
+func countAnswersHandler(store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		includeDrafts, err := parseBoolParam(r, "includeDrafts")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var count int
+		if includeDrafts {
+			count = store.count()
+		} else {
+			count = store.countMatching(withoutDrafts(nil))
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"count": count})
+	}
+}
+
+type searchMatch struct {
+	StoredSubmission
+	// MatchedQuestions lists the questions whose answers contain the query.
+	MatchedQuestions []int `json:"matchedQuestions"`
+}
+
+type searchPage struct {
+	Submissions []searchMatch `json:"submissions"`
+	Total       int           `json:"total"`
+	Limit       int           `json:"limit"`
+	Offset      int           `json:"offset"`
+}
+
+// searchAnswersHandler finds submissions whose text or email answers contain
+// ?q case-insensitively, for looking up a respondent by name or address.
+func searchAnswersHandler(qs *questionSet, store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		needle := strings.ToLower(strings.TrimSpace(query.Get("q")))
+		if needle == "" {
+			writeError(w, http.StatusBadRequest, "q is required")
+			return
+		}
+		limit, err := parseNonNegativeInt(query.Get("limit"), defaultPageLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		offset, err := parseNonNegativeInt(query.Get("offset"), 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		limit = min(limit, maxPageLimit)
+		subs, err := finalSubmissions(r, store)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		byID := qs.snapshot().byID
+		matches := make([]searchMatch, 0)
+		for _, sub := range subs {
+			var matched []int
+			for _, a := range sub.Answers {
+				q := byID[a.QuestionID]
+				if (q.Type == "text" || q.Type == "email" || q.Type == "url") && strings.Contains(strings.ToLower(a.Value), needle) && !slices.Contains(matched, q.ID) {
+					matched = append(matched, q.ID)
+				}
+			}
+			if matched != nil {
+				matches = append(matches, searchMatch{StoredSubmission: sub, MatchedQuestions: matched})
+			}
+		}
+
+		page := searchPage{Submissions: []searchMatch{}, Total: len(matches), Limit: limit, Offset: offset}
+		if offset < len(matches) {
+			page.Submissions = matches[offset:min(offset+limit, len(matches))]
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// parseBoolParam reads an optional boolean query parameter.
+func parseBoolParam(r *http.Request, name string) (bool, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return b, nil
+}
+
+// finalSubmissions returns the stored submissions for reports, leaving out
+// drafts unless the request asks for ?includeDrafts=true.
+func finalSubmissions(r *http.Request, store *answerStore) ([]StoredSubmission, error) {
+	includeDrafts, err := parseBoolParam(r, "includeDrafts")
+	if err != nil {
+		return nil, err
+	}
+	subs := store.snapshot()
+	if !includeDrafts {
+		subs = slices.DeleteFunc(subs, func(sub StoredSubmission) bool { return sub.Status == statusDraft })
+	}
+	return subs, nil
+}
+
+// withoutDrafts narrows match, which may be nil, to final submissions.
+func withoutDrafts(match func(StoredSubmission) bool) func(StoredSubmission) bool {
+	return func(sub StoredSubmission) bool {
+		return sub.Status != statusDraft && (match == nil || match(sub))
+	}
+}
+
+func parseNonNegativeInt(raw string, fallback int) (int, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("negative value")
+	}
+	return n, nil
+}
+
+func getAnswerHandler(store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid submission id")
+			return
+		}
+
+		sub, ok := store.get(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "submission not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, sub)
+	}
+}
+
+// deleteAnswerHandler removes a submission together with its uploaded files.
+func deleteAnswerHandler(qs *questionSet, store *answerStore, trail auditTrail, uploadsDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid submission id")
+			return
+		}
+
+		sub, _ := store.get(id)
+		deleted, err := store.delete(id)
+		if err != nil {
+			slog.Error("delete answers", "request_id", requestID(r.Context()), "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to delete submission")
+			return
+		}
+		if !deleted {
+			writeError(w, http.StatusNotFound, "submission not found")
+			return
+		}
+		trail.record(r, auditDelete, id, nil, "")
+		removeUploads(qs, uploadsDir, sub)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// createAnswersHandler stores a submission. The whole request is validated
+// before anything is saved, so a rejected request never leaves a partial
+// submission behind.
+func createAnswersHandler(qs *questionSet, store *answerStore, hook *webhookNotifier, trail auditTrail, maxBodySize int64, maxAnswers int, captureMeta bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		draft, err := parseBoolParam(r, "draft")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		key := r.Header.Get(idempotencyKeyHeader)
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+
+		var req AnswersRequest
+		if !decodeJSONBody(w, r, maxBodySize, &req) {
+			return
+		}
+		if errs := validateSubmission(qs, req, draft, maxAnswers); len(errs) > 0 {
+			serverMetrics.validationFailures.Add(1)
+			writeErrors(w, http.StatusBadRequest, errs)
+			return
+		}
+
+		status := statusFinal
+		if draft {
+			status = statusDraft
+		} else {
+			applyDefaults(qs, &req)
+		}
+		var meta submissionMeta
+		if captureMeta {
+			meta = requestMeta(r)
+		}
+		uploads := slices.ContainsFunc(qs.all(), func(q Question) bool { return q.Type == "file" })
+		sub, err := store.save(req, status, clientIP(r), key, meta, uploads)
+		var replayed *replayedSubmissionError
+		if errors.As(err, &replayed) {
+			slog.Debug("idempotent request replayed", "request_id", requestID(r.Context()), "submission_id", replayed.Sub.ID)
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeSaved(w, r, http.StatusOK, replayed.Sub)
+			return
+		}
+		if errors.Is(err, errIdempotencyKeyReused) {
+			writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with different answers")
+			return
+		}
+		if errors.Is(err, errSubmissionCapReached) {
+			slog.Debug("submission cap reached", "request_id", requestID(r.Context()), "client", clientIP(r))
+			writeError(w, http.StatusConflict, "this client has already submitted the maximum number of responses")
+			return
+		}
+		var duplicate *duplicateSubmissionError
+		if errors.As(err, &duplicate) {
+			slog.Debug("duplicate submission rejected", "request_id", requestID(r.Context()), "duplicate_of", duplicate.ID)
+			writeJSON(w, http.StatusConflict, struct {
+				errorResponse
+				ID int `json:"id"`
+			}{newErrorResponse(w, []apiError{{Message: "identical answers were already submitted"}}), duplicate.ID})
+			return
+		}
+		if err != nil {
+			slog.Error("save answers", "request_id", requestID(r.Context()), "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to save answers")
+			return
+		}
+		trail.record(r, auditCreate, sub.ID, sub.Answers, sub.Status)
+		if !draft {
+			serverMetrics.submissions.Add(1)
+			hook.notify(sub)
+		}
+		writeSaved(w, r, http.StatusCreated, sub)
+	}
+}
+
+// validateAnswersHandler runs the checks of POST /answers without storing
+// anything, so clients can show errors while the respondent fills the form.
+// The result is always 200; valid tells whether the submission would be
+// accepted.
+func validateAnswersHandler(qs *questionSet, maxBodySize int64, maxAnswers int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		draft, err := parseBoolParam(r, "draft")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var req AnswersRequest
+		if !decodeJSONBody(w, r, maxBodySize, &req) {
+			return
+		}
+
+		errs := validateSubmission(qs, req, draft, maxAnswers)
+		if len(errs) > 0 {
+			writeJSON(w, http.StatusOK, struct {
+				Valid bool `json:"valid"`
+				errorResponse
+			}{false, newErrorResponse(w, errs)})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"valid": true})
+	}
+}
+
+// idempotencyKeyHeader lets clients retry POST /answers safely: a repeated
+// key returns the original submission instead of storing another one.
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+)
+
+// writeSaved answers a POST /answers that stored sub with status, pointing
+// Location at the new submission under the path the request came in on.
+func writeSaved(w http.ResponseWriter, r *http.Request, status int, sub StoredSubmission) {
+	collection := r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		collection = u.Path
+	}
+	w.Header().Set("Location", strings.TrimSuffix(collection, "/")+"/"+strconv.Itoa(sub.ID))
+	writeJSON(w, status, sub)
+}
+
+// updateAnswersHandler replaces the answers of a stored submission. Uploaded
+// files are kept, since they can't be sent in the request body. Without
+// ?draft=true the submission becomes final and is fully validated; a final
+// submission can't go back to being a draft.
+func updateAnswersHandler(qs *questionSet, store *answerStore, hook *webhookNotifier, trail auditTrail, maxBodySize int64, maxAnswers int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid submission id")
+			return
+		}
+		draft, err := parseBoolParam(r, "draft")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		existing, ok := store.get(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "submission not found")
+			return
+		}
+		if draft && existing.Status == statusFinal {
+			writeError(w, http.StatusConflict, "a final submission can't be turned back into a draft")
+			return
+		}
+
+		var req AnswersRequest
+		if !decodeJSONBody(w, r, maxBodySize, &req) {
+			return
+		}
+		if errs := validateSubmission(qs, req, draft, maxAnswers); len(errs) > 0 {
+			serverMetrics.validationFailures.Add(1)
+			writeErrors(w, http.StatusBadRequest, errs)
+			return
+		}
+		status := statusDraft
+		if !draft {
+			status = statusFinal
+			applyDefaults(qs, &req)
+		}
+
+		byID := qs.snapshot().byID
+		isFile := func(a Answer) bool { return byID[a.QuestionID].Type == "file" }
+		sub, found, err := store.update(id, req.Answers, status, isFile)
+		if err != nil {
+			slog.Error("update answers", "request_id", requestID(r.Context()), "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to update submission")
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "submission not found")
+			return
+		}
+		slog.Info("submission updated", "request_id", requestID(r.Context()), "submission_id", sub.ID)
+		trail.record(r, auditUpdate, sub.ID, sub.Answers, sub.Status)
+		if existing.Status == statusDraft && sub.Status == statusFinal {
+			serverMetrics.submissions.Add(1)
+			hook.notify(sub)
+		}
+		writeJSON(w, http.StatusOK, sub)
+	}
+}
+
+// importMaxBodySize caps POST /answers/import bodies, which carry many
+// submissions at once.
+const importMaxBodySize = 32 << 20
+
+type importResult struct {
+	Imported int               `json:"imported"`
+	Rejected []importRejection `json:"rejected"`
+}
+
+func importAnswersHandler(qs *questionSet, store *answerStore, trail auditTrail, maxAnswers int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var subs []StoredSubmission
+		if !decodeJSONBody(w, r, importMaxBodySize, &subs) {
+			return
+		}
+
+		result := importResult{Rejected: []importRejection{}}
+		valid := make([]StoredSubmission, 0, len(subs))
+		indexes := make([]int, 0, len(subs))
+		for i, sub := range subs {
+			if sub.Status != "" && sub.Status != statusDraft && sub.Status != statusFinal {
+				result.Rejected = append(result.Rejected, importRejection{Index: i, ID: sub.ID, Errors: []apiError{{Message: "status must be draft or final"}}})
+				continue
+			}
+			if apiErr := checkAnswerCount(qs, sub.Answers, maxAnswers); apiErr != nil {
+				result.Rejected = append(result.Rejected, importRejection{Index: i, ID: sub.ID, Errors: []apiError{*apiErr}})
+				continue
+			}
+			normalizeAnswers(qs, sub.Answers)
+			validate := validateAnswers
+			if sub.Status == statusDraft {
+				validate = validateDraftAnswers
+			}
+			if errs := validate(qs, AnswersRequest{Answers: sub.Answers}); len(errs) > 0 {
+				result.Rejected = append(result.Rejected, importRejection{Index: i, ID: sub.ID, Errors: errs})
+				continue
+			}
+			valid = append(valid, sub)
+			indexes = append(indexes, i)
+		}
+
+		imported, rejected, err := store.importAll(valid, indexes)
+		if err != nil {
+			slog.Error("import answers", "request_id", requestID(r.Context()), "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to import submissions")
+			return
+		}
+		for _, sub := range imported {
+			trail.record(r, auditImport, sub.ID, sub.Answers, sub.Status)
+		}
+		result.Imported = len(imported)
+		result.Rejected = append(result.Rejected, rejected...)
+		slices.SortFunc(result.Rejected, func(a, b importRejection) int { return a.Index - b.Index })
+
+		slog.Info("answers imported", "request_id", requestID(r.Context()), "imported", result.Imported, "rejected", len(result.Rejected))
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// decodeJSONBody decodes a JSON request body of at most maxBodySize bytes into
+// dst. On failure it writes the error response and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, maxBodySize int64, dst any) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit))
+			return false
+		}
+		if errors.Is(err, errInvalidAnswerValue) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+		// The decoder has no typed error for unknown fields.
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			writeError(w, http.StatusBadRequest, "unknown field "+field)
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return false
+	}
+	return true
+}
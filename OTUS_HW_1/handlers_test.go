@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCreateAnswersRejectsWholeRequest checks that one invalid answer keeps
+// the valid ones from being stored too.
+func TestCreateAnswersRejectsWholeRequest(t *testing.T) {
+	qs, err := newQuestionSet([]Question{
+		{ID: 1, Text: LocalizedText{"": "Name"}, Type: "text", Required: true},
+		{ID: 2, Text: LocalizedText{"": "Age"}, Type: "number", Min: ptr(0.0), Max: ptr(150.0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := newAnswerStore("", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := newAuditLog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := createAnswersHandler(qs, store, nil, auditTrail{log: audit}, 1<<20, 0, false)
+
+	body := `{"answers":[{"questionId":1,"value":"Ivan"},{"questionId":2,"value":"200"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/answers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if n := store.count(); n != 0 {
+		t.Fatalf("store has %d submissions after a rejected request, want 0", n)
+	}
+}
+
+// TestImportAnswersKeepsDrafts checks that an exported draft with a required
+// question left unanswered can be imported back.
+func TestImportAnswersKeepsDrafts(t *testing.T) {
+	qs, err := newQuestionSet([]Question{
+		{ID: 1, Text: LocalizedText{"": "Name"}, Type: "text", Required: true},
+		{ID: 2, Text: LocalizedText{"": "Comment"}, Type: "text"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := newAnswerStore("", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft, err := source.save(AnswersRequest{Answers: []Answer{{QuestionID: 2, Value: "later"}}}, statusDraft, "", "", submissionMeta{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(source.snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := newAnswerStore("", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := newAuditLog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := importAnswersHandler(qs, store, auditTrail{log: audit}, 0)
+
+	req := httptest.NewRequest(http.MethodPost, "/answers/import", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var result importResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || len(result.Rejected) != 0 {
+		t.Fatalf("imported %d, rejected %v; want 1 imported, none rejected", result.Imported, result.Rejected)
+	}
+	got, ok := store.get(draft.ID)
+	if !ok {
+		t.Fatalf("submission %d not found after import", draft.ID)
+	}
+	if got.Status != statusDraft || len(got.Answers) != 1 || got.Answers[0].Value != "later" {
+		t.Fatalf("imported submission = %+v, want the draft %+v", got, draft)
+	}
+}
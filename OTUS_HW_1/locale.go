@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocalizedText is text in one or more locales. In JSON it is either a plain
+// string, which serves every locale, or an object keyed by locale such as
+// {"ru":"Да","en":"Yes"}. A plain string is kept under the empty key.
+type LocalizedText map[string]string
+
+func (t *LocalizedText) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*t = LocalizedText{"": plain}
+		return nil
+	}
+	var byLocale map[string]string
+	if err := json.Unmarshal(data, &byLocale); err != nil {
+		return errors.New("text must be a string or an object mapping locales to text")
+	}
+	*t = make(LocalizedText, len(byLocale))
+	for locale, text := range byLocale {
+		(*t)[strings.ToLower(locale)] = text
+	}
+	return nil
+}
+
+func (t LocalizedText) MarshalJSON() ([]byte, error) {
+	if plain, ok := t[""]; ok && len(t) == 1 {
+		return json.Marshal(plain)
+	}
+	return json.Marshal(map[string]string(t))
+}
+
+// String returns the text without locale preferences: the plain string, or
+// else the first locale in alphabetical order.
+func (t LocalizedText) String() string {
+	if plain, ok := t[""]; ok {
+		return plain
+	}
+	locales := make([]string, 0, len(t))
+	for locale := range t {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	if len(locales) == 0 {
+		return ""
+	}
+	return t[locales[0]]
+}
+
+// lookup returns the text for the first preferred locale that has one,
+// matching "en-us" against "en" as well, then for defaultLocale and then the
+// plain string.
+func (t LocalizedText) lookup(prefs []string, defaultLocale string) (string, bool) {
+	for _, locale := range prefs {
+		if text, ok := t[locale]; ok {
+			return text, true
+		}
+		if base, _, found := strings.Cut(locale, "-"); found {
+			if text, ok := t[base]; ok {
+				return text, true
+			}
+		}
+	}
+	if text, ok := t[strings.ToLower(defaultLocale)]; ok {
+		return text, true
+	}
+	text, ok := t[""]
+	return text, ok
+}
+
+// pick is like lookup but falls back to String when no locale matches.
+func (t LocalizedText) pick(prefs []string, defaultLocale string) string {
+	if text, ok := t.lookup(prefs, defaultLocale); ok {
+		return text
+	}
+	return t.String()
+}
+
+// parseAcceptLanguage returns the locales of an Accept-Language header in
+// order of preference, lowercased. Wildcards and q=0 entries are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var entries []weighted
+	for _, part := range strings.Split(header, ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		locale = strings.ToLower(strings.TrimSpace(locale))
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			entries = append(entries, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].q > entries[j].q })
+
+	locales := make([]string, len(entries))
+	for i, e := range entries {
+		locales[i] = e.locale
+	}
+	return locales
+}
+
+// localizeQuestions returns copies of list with text and option labels
+// reduced to a single locale, so clients always see plain strings. Options
+// without a label in that locale are left out and shown as their value.
+func localizeQuestions(list []Question, prefs []string, defaultLocale string) []Question {
+	localized := make([]Question, len(list))
+	for i, q := range list {
+		q.Text = LocalizedText{"": q.Text.pick(prefs, defaultLocale)}
+		if q.OptionLabels != nil {
+			labels := make(map[string]LocalizedText, len(q.OptionLabels))
+			for option, label := range q.OptionLabels {
+				if text, ok := label.lookup(prefs, defaultLocale); ok {
+					labels[option] = LocalizedText{"": text}
+				}
+			}
+			q.OptionLabels = labels
+		}
+		localized[i] = q
+	}
+	return localized
+}
@@ -1,79 +1,303 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
-type Question struct {
-	ID   int    `json:"id"`
-	Text string `json:"text"`
-	Type string `json:"type"`
-}
-
+// Answer is encoded with the native JSON type of its question, see
+// MarshalJSON in answervalue.go.
 type Answer struct {
 	QuestionID int    `json:"questionId"`
 	Value      string `json:"value"`
+	kind       valueKind
 }
 
 type AnswersRequest struct {
 	Answers []Answer `json:"answers"`
 }
 
-var questions = []Question{
-	{ID: 1, Text: "Как вас зовут?", Type: "text"},
-	{ID: 2, Text: "Сколько вам лет?", Type: "number"},
-	{ID: 3, Text: "Ваш любимый язык программирования?", Type: "text"},
-	{ID: 4, Text: "Готовы учить Go глубже?", Type: "text"},
+type StoredSubmission struct {
+	ID          int        `json:"id"`
+	Status      string     `json:"status"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	ModifiedAt  *time.Time `json:"modifiedAt,omitempty"`
+	Answers     []Answer   `json:"answers"`
+	// DraftToken lets the respondent finish a draft without admin
+	// credentials. It is cleared once the submission is final.
+	DraftToken string `json:"draftToken,omitempty"`
+	// UploadToken authorizes the respondent to upload files to the
+	// submission. It is only issued when the survey has file questions.
+	UploadToken string `json:"uploadToken,omitempty"`
+	// UserAgent and Referer are captured from the request that created the
+	// submission, unless disabled with -capture-metadata=false.
+	UserAgent string `json:"userAgent,omitempty"`
+	Referer   string `json:"referer,omitempty"`
 }
 
-type answerStore struct {
-	mu      sync.Mutex
-	answers []AnswersRequest
+// submissionMeta is the request context stored with a new submission.
+type submissionMeta struct {
+	UserAgent string
+	Referer   string
 }
 
-func (s *answerStore) save(req AnswersRequest) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.answers = append(s.answers, req)
+// maxMetaLength caps each captured header so a client can't bloat the store.
+const maxMetaLength = 512
+
+func requestMeta(r *http.Request) submissionMeta {
+	truncate := func(s string) string {
+		if len(s) > maxMetaLength {
+			return strings.ToValidUTF8(s[:maxMetaLength], "")
+		}
+		return s
+	}
+	return submissionMeta{UserAgent: truncate(r.UserAgent()), Referer: truncate(r.Referer())}
 }
 
+// Submission statuses. Drafts skip required questions and stay out of
+// statistics until they are finalized.
+const (
+	statusDraft = "draft"
+	statusFinal = "final"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+// exitAddrInUse is the exit code when the listen address is already taken,
+// so scripts can tell it apart from other failures, which exit with 1.
+const exitAddrInUse = 3
+
+// apiPrefix is where the current version of the API is mounted.
+const apiPrefix = "/v1"
+
+// apiMethods are routed to the API mux, which answers the ones a path doesn't
+// support with 405 itself.
+var apiMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// legacyAPIPaths are the unversioned API paths kept for older clients.
+var legacyAPIPaths = []string{"/questions", "/questions/", "/answers", "/answers/", "/stats", "/results", "/surveys", "/surveys/"}
+
 func main() {
-	store := &answerStore{answers: make([]AnswersRequest, 0)}
+	cfg := loadConfig()
+
+	qs, err := loadQuestions(cfg.QuestionsFile)
+	if err != nil {
+		fatal("load questions", "error", err)
+	}
+
+	store, err := newAnswerStore(cfg.AnswersFile, cfg.DedupWindow, cfg.IdempotencyTTL, cfg.MaxSubmissionsPerIP)
+	if err != nil {
+		fatal("load answers", "error", err)
+	}
+	defaultSurvey := &Survey{ID: defaultSurveyID, questions: qs, store: store, uploadsDir: cfg.UploadsDir}
+
+	surveys, err := loadSurveys(cfg)
+	if err != nil {
+		fatal("load surveys", "error", err)
+	}
+	allSurveys := append([]*Survey{defaultSurvey}, sortedSurveys(surveys)...)
+	for _, s := range allSurveys {
+		s.store.setAnswerKinds(s.questions.snapshot().byID)
+	}
+
+	audit, err := newAuditLog(cfg.AuditFile)
+	if err != nil {
+		fatal("load audit log", "error", err)
+	}
 
 	mux := http.NewServeMux()
+	admin := basicAuth(cfg.AdminUser, cfg.AdminPass)
+	limits := newRateLimits(cfg.RateLimit, cfg.RateBurst)
+	hook := newWebhookNotifier(cfg.WebhookURL)
+	routes := func(s *Survey) http.Handler {
+		return surveyRoutes(s, cfg, admin, limits, hook, audit)
+	}
 
-	mux.HandleFunc("GET /questions", func(w http.ResponseWriter, r *http.Request) {
-		writeJSON(w, http.StatusOK, questions)
-	})
+	mux.HandleFunc("GET /healthz", healthHandler())
+	mux.HandleFunc("GET /readyz", readyHandler(allSurveys))
+	mux.HandleFunc("GET /version", versionHandler())
+	mux.HandleFunc("GET /metrics", metricsHandler(serverMetrics, allSurveys))
 
-	mux.HandleFunc("POST /answers", func(w http.ResponseWriter, r *http.Request) {
-		var req AnswersRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid JSON payload", http.StatusBadRequest)
-			return
+	api := surveyRoutes(defaultSurvey, cfg, admin, limits, hook, audit)
+	api.HandleFunc("GET /surveys", admin(listSurveysHandler(surveys)))
+	api.Handle("/surveys/{surveyId}/", surveyHandler(surveys, routes))
+
+	versioned := withJSONNotFound(http.StripPrefix(apiPrefix, api))
+	legacy := withJSONNotFound(deprecatedAlias(apiPrefix, api))
+	for _, method := range apiMethods {
+		mux.Handle(method+" "+apiPrefix+"/", versioned)
+		for _, path := range legacyAPIPaths {
+			mux.Handle(method+" "+path, legacy)
+		}
+	}
+
+	checkStaticDir(cfg.StaticDir)
+	var fs http.Handler = http.FileServer(http.Dir(cfg.StaticDir))
+	if cfg.SPAMode {
+		fs = spaFallback(cfg.StaticDir, fs)
+	}
+	mux.Handle("GET /", withAPINotFound(cfg.StaticDir, fs))
+
+	addr := cfg.Addr
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      withRequestID(withClientIP(cfg.TrustProxy, cfg.TrustedProxies, withLogging(withCORS(cfg.CORSOrigins, cfg.CORSCredentials, withGzip(withTimeout(cfg.RequestTimeout, withRecovery(withJSONMethodNotAllowed(mux)))))))),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+		ErrorLog:     slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	// Shutdown waits for active requests, so open event streams are ended.
+	for _, s := range allSurveys {
+		server.RegisterOnShutdown(s.store.closeSubscribers)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("starting", "version", version, "commit", commit, "built", buildTime)
+
+	// Listening before serving lets a taken port be reported on its own and
+	// keeps "server started" from being logged when the server can't start.
+	listenAddr := addr
+	if listenAddr == "" {
+		listenAddr = ":http"
+		if cfg.TLSCert != "" {
+			listenAddr = ":https"
 		}
+	}
+	ln, err := net.Listen("tcp", listenAddr)
+	if isAddrInUse(err) {
+		slog.Error("address already in use: another process (maybe a second instance of this server) is listening on it; stop it or choose a different address with ADDR or -addr, e.g. ADDR=:8081", "addr", listenAddr)
+		os.Exit(exitAddrInUse)
+	}
+	if err != nil {
+		fatal("listen", "error", err)
+	}
 
-		store.save(req)
-		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
-	})
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLSCert != "" {
+			slog.Info("server started", "url", "https://localhost"+addr, "tls", true, "api", apiPrefix)
+			serveErr <- server.ServeTLS(ln, cfg.TLSCert, cfg.TLSKey)
+			return
+		}
+		slog.Info("server started", "url", "http://localhost"+addr, "tls", false, "api", apiPrefix)
+		serveErr <- server.Serve(ln)
+	}()
 
-	fs := http.FileServer(http.Dir("./static"))
-	mux.Handle("/", fs)
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("server error", "error", err)
+		}
+	case <-ctx.Done():
+		stop()
+		slog.Info("shutting down, waiting for in-flight requests", "timeout", shutdownTimeout)
 
-	addr := ":8080"
-	log.Printf("Server started on http://localhost%s\n", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatal(err)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			fatal("shutdown", "error", err)
+		}
+		audit.close()
+		slog.Info("server stopped")
 	}
 }
 
+// surveyRoutes registers the API of a single survey on a new mux.
+func surveyRoutes(s *Survey, cfg config, admin func(http.HandlerFunc) http.HandlerFunc, limits rateLimits, hook *webhookNotifier, audit *auditLog) *http.ServeMux {
+	qs, store := s.questions, s.store
+	trail := auditTrail{log: audit, survey: s.ID}
+	api := http.NewServeMux()
+	api.HandleFunc("GET /questions", questionsHandler(qs, cfg.DefaultLocale))
+	api.HandleFunc("GET /questions/schema", schemaHandler(qs, cfg.DefaultLocale))
+	api.HandleFunc("GET /questions/grouped", groupedQuestionsHandler(qs, cfg.DefaultLocale))
+	api.HandleFunc("POST /questions", admin(createQuestionHandler(qs, cfg.MaxBodySize)))
+	api.HandleFunc("PUT /questions/{id}", admin(updateQuestionHandler(qs, store, cfg.MaxBodySize)))
+	api.HandleFunc("GET /answers", admin(listAnswersHandler(qs, store)))
+	api.HandleFunc("GET /answers/search", admin(searchAnswersHandler(qs, store)))
+	api.HandleFunc("GET /answers/count", admin(countAnswersHandler(store)))
+	api.HandleFunc("GET /answers/{id}", admin(getAnswerHandler(store)))
+	api.HandleFunc("GET /answers/{id}/score", admin(scoreHandler(qs, store)))
+	api.HandleFunc("POST /answers/import", admin(importAnswersHandler(qs, store, trail, cfg.MaxAnswers)))
+	api.HandleFunc("PUT /answers/{id}", draftOwner(admin, store)(updateAnswersHandler(qs, store, hook, trail, cfg.MaxBodySize, cfg.MaxAnswers)))
+	api.HandleFunc("DELETE /answers/{id}", admin(deleteAnswerHandler(qs, store, trail, s.uploadsDir)))
+	api.HandleFunc("GET /answers/stream", admin(streamAnswersHandler(store)))
+	api.HandleFunc("GET /answers/export.csv", admin(exportCSVHandler(qs, store, cfg.DefaultLocale)))
+	api.HandleFunc("GET /answers/export.jsonl", admin(exportJSONLHandler(store)))
+	api.HandleFunc("GET /stats", admin(statsHandler(qs, store)))
+	api.HandleFunc("GET /results", admin(resultsHandler(qs, store, cfg.DefaultLocale)))
+	api.HandleFunc("GET /admin/backup", admin(backupHandler(qs, store)))
+	api.HandleFunc("GET /admin/audit", admin(auditHandler(trail)))
+	api.HandleFunc("POST /admin/reset", admin(resetHandler(qs, store, trail, s.uploadsDir, cfg.AllowReset)))
+	api.HandleFunc("POST /admin/restore", admin(restoreHandler(qs, store, trail)))
+	api.HandleFunc("POST /answers", limits.submit(createAnswersHandler(qs, store, hook, trail, cfg.MaxBodySize, cfg.MaxAnswers, cfg.CaptureMetadata)))
+	api.HandleFunc("POST /answers/validate", limits.validate(validateAnswersHandler(qs, cfg.MaxBodySize, cfg.MaxAnswers)))
+	api.HandleFunc("POST /answers/{submissionId}/files/{questionId}", limits.upload(uploadOwner(admin, store)(uploadFileHandler(qs, store, trail, s.uploadsDir))))
+	return api
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		log.Printf("write json error: %v", err)
+		slog.Error("write json", "error", err)
+	}
+}
+
+type apiError struct {
+	QuestionID *int   `json:"questionId,omitempty"`
+	Message    string `json:"message"`
+}
+
+type errorResponse struct {
+	Errors    []apiError `json:"errors"`
+	RequestID string     `json:"requestId,omitempty"`
+}
+
+// newErrorResponse wraps errs together with the request ID that
+// withRequestID put in the response headers.
+func newErrorResponse(w http.ResponseWriter, errs []apiError) errorResponse {
+	return errorResponse{Errors: errs, RequestID: w.Header().Get(requestIDHeader)}
+}
+
+func questionError(questionID int, message string) apiError {
+	return apiError{QuestionID: &questionID, Message: message}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeErrors(w, status, []apiError{{Message: message}})
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs []apiError) {
+	writeJSON(w, status, newErrorResponse(w, errs))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func checkStaticDir(dir string) {
+	if dir == "" {
+		slog.Warn("static dir is empty, frontend files will not be served")
+		return
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		slog.Warn("static dir is not accessible", "dir", dir, "error", err)
+		return
+	}
+	if !info.IsDir() {
+		slog.Warn("static dir is not a directory", "dir", dir)
 	}
 }
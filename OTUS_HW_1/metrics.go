@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics holds the counters exposed on /metrics in the Prometheus text
+// format.
+type metrics struct {
+	submissions        atomic.Int64
+	validationFailures atomic.Int64
+
+	mu            sync.Mutex
+	bucketCounts  []int64
+	durationSum   float64
+	durationCount int64
+}
+
+var serverMetrics = newMetrics()
+
+func newMetrics() *metrics {
+	return &metrics{bucketCounts: make([]int64, len(durationBuckets))}
+}
+
+func (m *metrics) observeDuration(d time.Duration) {
+	seconds := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, upper := range durationBuckets {
+		if seconds <= upper {
+			m.bucketCounts[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+func metricsHandler(m *metrics, surveys []*Survey) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		fmt.Fprintln(w, "# HELP survey_submissions_total Total number of accepted submissions.")
+		fmt.Fprintln(w, "# TYPE survey_submissions_total counter")
+		fmt.Fprintf(w, "survey_submissions_total %d\n", m.submissions.Load())
+
+		fmt.Fprintln(w, "# HELP survey_validation_failures_total Total number of submissions rejected by validation.")
+		fmt.Fprintln(w, "# TYPE survey_validation_failures_total counter")
+		fmt.Fprintf(w, "survey_validation_failures_total %d\n", m.validationFailures.Load())
+
+		fmt.Fprintln(w, "# HELP survey_stored_submissions Number of submissions currently stored.")
+		fmt.Fprintln(w, "# TYPE survey_stored_submissions gauge")
+		for _, s := range surveys {
+			fmt.Fprintf(w, "survey_stored_submissions{survey=%q} %d\n", s.ID, s.store.count())
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		fmt.Fprintln(w, "# HELP http_request_duration_seconds Duration of HTTP requests.")
+		fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+		for i, upper := range durationBuckets {
+			fmt.Fprintf(w, "http_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(upper, 'g', -1, 64), m.bucketCounts[i])
+		}
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durationCount)
+		fmt.Fprintf(w, "http_request_duration_seconds_sum %g\n", m.durationSum)
+		fmt.Fprintf(w, "http_request_duration_seconds_count %d\n", m.durationCount)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// withLogging logs every request as key=value pairs once the handler returns.
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		serverMetrics.observeDuration(duration)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		slog.Info("request", "request_id", requestID(r.Context()), "client", clientIP(r), "method", r.Method, "path", r.URL.Path, "status", status, "duration", duration)
+	})
+}
+
+// withCORS allows cross-origin requests from the given origins and answers
+// their preflight requests without reaching the wrapped handler. "*" allows
+// any origin; otherwise the request's Origin is echoed back only when it is
+// in the list, and requests from other origins get no CORS headers. With
+// credentials, browsers may send cookies and Authorization cross-origin.
+func withCORS(origins []string, credentials bool, next http.Handler) http.Handler {
+	wildcard := slices.Contains(origins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := "*"
+		if !wildcard {
+			// The response depends on Origin, so caches must keep them apart.
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			if origin == "" || !slices.ContainsFunc(origins, func(o string) bool { return strings.EqualFold(o, origin) }) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			allowed = origin
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+		if credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, X-Draft-Token, X-Upload-Token, Idempotency-Key")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseOrigins splits a comma-separated list of origins such as
+// "https://a.example, https://b.example". Trailing slashes are dropped,
+// since browsers never send them in Origin.
+func parseOrigins(list string) []string {
+	var origins []string
+	for _, part := range strings.Split(list, ",") {
+		if part = strings.TrimSuffix(strings.TrimSpace(part), "/"); part != "" {
+			origins = append(origins, part)
+		}
+	}
+	return origins
+}
+
+// basicAuth returns a wrapper that requires the given credentials. It is a
+// no-op when both user and password are empty.
+func basicAuth(user, password string) func(http.HandlerFunc) http.HandlerFunc {
+	if user == "" && password == "" {
+		return func(next http.HandlerFunc) http.HandlerFunc { return next }
+	}
+
+	wantUser := sha256.Sum256([]byte(user))
+	wantPassword := sha256.Sum256([]byte(password))
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			gotUser, gotPassword, ok := r.BasicAuth()
+			userHash := sha256.Sum256([]byte(gotUser))
+			passwordHash := sha256.Sum256([]byte(gotPassword))
+			userMatch := subtle.ConstantTimeCompare(userHash[:], wantUser[:])
+			passwordMatch := subtle.ConstantTimeCompare(passwordHash[:], wantPassword[:])
+			if !ok || userMatch&passwordMatch != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+				writeError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// draftOwnerHeader carries the token returned when a draft is created.
+const (
+	draftOwnerHeader  = "X-Draft-Token"
+	uploadOwnerHeader = "X-Upload-Token"
+)
+
+// draftOwner lets a request with the draft's token through to next without
+// admin credentials; everything else goes through admin. The submission id
+// is taken from the {id} path value.
+func draftOwner(admin func(http.HandlerFunc) http.HandlerFunc, store *answerStore) func(http.HandlerFunc) http.HandlerFunc {
+	return tokenOwner(admin, "id", draftOwnerHeader, store.draftToken)
+}
+
+// uploadOwner is draftOwner for file uploads: the submission's upload token
+// is taken from X-Upload-Token and its id from the {submissionId} path value.
+func uploadOwner(admin func(http.HandlerFunc) http.HandlerFunc, store *answerStore) func(http.HandlerFunc) http.HandlerFunc {
+	return tokenOwner(admin, "submissionId", uploadOwnerHeader, store.uploadToken)
+}
+
+// tokenOwner lets a request through to next when its header matches the token
+// of the submission named by the idParam path value, and sends the rest
+// through admin.
+func tokenOwner(admin func(http.HandlerFunc) http.HandlerFunc, idParam, header string, token func(id int) string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		protected := admin(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			got := r.Header.Get(header)
+			if id, err := strconv.Atoi(r.PathValue(idParam)); err == nil && got != "" {
+				want := token(id)
+				if want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 {
+					next(w, r)
+					return
+				}
+			}
+			protected(w, r)
+		}
+	}
+}
+
+// withRecovery turns a panicking handler into a 500 response and logs the
+// panic with its stack trace. If the handler already started the response,
+// it can only be cut short.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// ErrAbortHandler is the documented way to abort a response
+			// and is not worth a stack trace.
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			slog.Error("panic", "request_id", requestID(r.Context()), "method", r.Method, "path", r.URL.Path, "error", err, "stack", string(debug.Stack()))
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// withTimeout gives every request a deadline. Handlers are expected to stop
+// when the request context is done; if they return without writing anything
+// after the deadline, the client gets a 503. Event streams and exports are
+// exempt.
+func withTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r) || isExport(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			writeError(w, http.StatusServiceUnavailable, "request timed out")
+		}
+	})
+}
+
+// plainErrorWriter replaces the plain-text error body that http.ServeMux
+// writes for status with the JSON error envelope. Responses that handlers
+// already encode as JSON pass through, and headers set by the mux, such as
+// Allow, are kept as is.
+type plainErrorWriter struct {
+	http.ResponseWriter
+	status      int
+	message     func(http.Header) string
+	intercepted bool
+}
+
+func (w *plainErrorWriter) WriteHeader(status int) {
+	contentType := w.Header().Get("Content-Type")
+	if status != w.status || w.intercepted || !strings.HasPrefix(contentType, "text/plain") {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.intercepted = true
+	w.Header().Del("X-Content-Type-Options")
+	writeError(w.ResponseWriter, status, w.message(w.Header()))
+}
+
+func (w *plainErrorWriter) Write(b []byte) (int, error) {
+	if w.intercepted {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *plainErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func withJSONMethodNotAllowed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&plainErrorWriter{
+			ResponseWriter: w,
+			status:         http.StatusMethodNotAllowed,
+			message: func(h http.Header) string {
+				return fmt.Sprintf("method %s is not allowed, use one of: %s", r.Method, h.Get("Allow"))
+			},
+		}, r)
+	})
+}
+
+// withJSONNotFound answers API paths that match no route with a JSON 404
+// instead of the mux's plain-text page.
+func withJSONNotFound(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&plainErrorWriter{
+			ResponseWriter: w,
+			status:         http.StatusNotFound,
+			message:        func(http.Header) string { return fmt.Sprintf("no API endpoint at %s", r.URL.Path) },
+		}, r)
+	})
+}
+
+// deprecatedAlias serves an unversioned API path with the handler mounted at
+// prefix, logging a warning and pointing the client to the versioned path.
+func deprecatedAlias(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Warn("deprecated path used", "request_id", requestID(r.Context()), "path", r.URL.Path, "replacement", prefix+r.URL.Path)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", prefix, r.URL.Path))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Question struct {
+	ID       int           `json:"id"`
+	Text     LocalizedText `json:"text"`
+	Type     string        `json:"type"`
+	Options  []string      `json:"options,omitempty"`
+	Required bool          `json:"required"`
+	Min      *float64      `json:"min,omitempty"`
+	Max      *float64      `json:"max,omitempty"`
+	// Integer makes a number question accept whole numbers only.
+	Integer    bool             `json:"integer,omitempty"`
+	Validation *ValidationRules `json:"validation,omitempty"`
+	MinDate    string           `json:"minDate,omitempty"`
+	MaxDate    string           `json:"maxDate,omitempty"`
+	ShowIf     *Condition       `json:"showIf,omitempty"`
+	MaxLength  int              `json:"maxLength,omitempty"`
+	Order      int              `json:"order"`
+	// MaxFileSize and AllowedTypes restrict uploads to file questions.
+	MaxFileSize  int64    `json:"maxFileSize,omitempty"`
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+	// AllowedHosts restricts the links accepted by url questions.
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+	// Section groups related questions; empty means defaultSection.
+	Section string `json:"section,omitempty"`
+	// Default is stored for an optional question the respondent skipped.
+	Default string `json:"default,omitempty"`
+	// OptionLabels translates the options of select and multiselect questions
+	// for display. Answers always use the option values themselves.
+	OptionLabels map[string]LocalizedText `json:"optionLabels,omitempty"`
+	// RequiredIf makes the question required only while the condition holds.
+	RequiredIf *Condition `json:"requiredIf,omitempty"`
+	// Scoring awards points for correct answers, see ScoringRule.
+	Scoring *ScoringRule `json:"scoring,omitempty"`
+}
+
+// Condition matches when the answer to QuestionID equals Value.
+type Condition struct {
+	QuestionID int    `json:"questionId"`
+	Value      string `json:"value"`
+}
+
+// dateLayout is the accepted format of date answers and date bounds.
+const dateLayout = time.DateOnly
+
+// ValidationRules are extra constraints for text and email answers.
+type ValidationRules struct {
+	Pattern   string `json:"pattern,omitempty"`
+	MinLength int    `json:"minLength,omitempty"`
+}
+
+var supportedQuestionTypes = []string{"text", "number", "select", "rating", "email", "date", "file", "multiselect", "url"}
+
+var defaultQuestions = []Question{
+	{ID: 1, Order: 10, Text: LocalizedText{"ru": "Как вас зовут?", "en": "What is your name?"}, Type: "text", Required: true, MaxLength: 100},
+	{ID: 2, Order: 20, Text: LocalizedText{"ru": "Сколько вам лет?", "en": "How old are you?"}, Type: "number", Required: true, Min: ptr(0.0), Max: ptr(150.0), Integer: true},
+	{ID: 3, Order: 30, Text: LocalizedText{"ru": "Ваш любимый язык программирования?", "en": "What is your favorite programming language?"}, Type: "text"},
+	{ID: 4, Order: 40, Text: LocalizedText{"ru": "Готовы учить Go глубже?", "en": "Are you ready to learn Go in more depth?"}, Type: "select", Options: []string{"Да", "Нет", "Пока не знаю"}, Required: true,
+		OptionLabels: map[string]LocalizedText{
+			"Да":           {"en": "Yes"},
+			"Нет":          {"en": "No"},
+			"Пока не знаю": {"en": "Not sure yet"},
+		}},
+	{ID: 5, Order: 60, Text: LocalizedText{"ru": "Оцените свой опыт с Go от 1 до 5", "en": "Rate your Go experience from 1 to 5"}, Type: "rating", Min: ptr(1.0), Max: ptr(5.0)},
+	{ID: 6, Order: 50, Text: LocalizedText{"ru": "Что хотите изучить в Go в первую очередь?", "en": "What do you want to learn in Go first?"}, Type: "text", Required: true, ShowIf: &Condition{QuestionID: 4, Value: "Да"}},
+}
+
+// questionSet holds the active survey questions. The list and the pattern
+// cache are replaced as a whole on every change, so values returned from
+// snapshot stay valid after the lock is released.
+type questionSet struct {
+	mu       sync.RWMutex
+	list     []Question
+	patterns map[int]*regexp.Regexp
+	// byID indexes list. It is built on first use and dropped whenever
+	// the list changes.
+	byID map[int]Question
+}
+
+// questionsView is a consistent, read-only view of a questionSet.
+type questionsView struct {
+	list     []Question
+	byID     map[int]Question
+	patterns map[int]*regexp.Regexp
+}
+
+func newQuestionSet(list []Question) (*questionSet, error) {
+	qs := &questionSet{}
+	if err := qs.replace(list); err != nil {
+		return nil, err
+	}
+	return qs, nil
+}
+
+// loadQuestions builds the question set from path. The built-in questions are
+// used when path is empty or the file does not exist.
+func loadQuestions(path string) (*questionSet, error) {
+	if path == "" {
+		return newQuestionSet(defaultQuestions)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Warn("questions file not found, using built-in questions", "path", path)
+		return newQuestionSet(defaultQuestions)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read questions file: %w", err)
+	}
+
+	var loaded []Question
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("parse questions file %s: %w", path, err)
+	}
+	if len(loaded) == 0 {
+		return nil, fmt.Errorf("questions file %s contains no questions", path)
+	}
+	qs, err := newQuestionSet(loaded)
+	if err != nil {
+		return nil, fmt.Errorf("questions file %s: %w", path, err)
+	}
+	return qs, nil
+}
+
+// defaultSection holds the questions that don't name a section.
+const defaultSection = "General"
+
+type questionSection struct {
+	Section   string     `json:"section"`
+	Questions []Question `json:"questions"`
+}
+
+// groupBySection splits an ordered list into sections, in the order each
+// section first appears.
+func groupBySection(list []Question) []questionSection {
+	groups := []questionSection{}
+	index := make(map[string]int)
+	for _, q := range list {
+		name := cmp.Or(q.Section, defaultSection)
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, questionSection{Section: name})
+		}
+		groups[i].Questions = append(groups[i].Questions, q)
+	}
+	return groups
+}
+
+// sortByOrder sorts questions for presentation: by Order, then by ID.
+func sortByOrder(list []Question) {
+	slices.SortStableFunc(list, func(a, b Question) int {
+		if a.Order != b.Order {
+			return cmp.Compare(a.Order, b.Order)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func (qs *questionSet) size() int {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+	return len(qs.list)
+}
+
+func (qs *questionSet) all() []Question {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+	return slices.Clone(qs.list)
+}
+
+// snapshot returns a copy of the questions with their ID index and compiled
+// patterns. The maps are shared and must not be modified.
+func (qs *questionSet) snapshot() questionsView {
+	qs.mu.RLock()
+	if qs.byID != nil {
+		defer qs.mu.RUnlock()
+		return questionsView{list: slices.Clone(qs.list), byID: qs.byID, patterns: qs.patterns}
+	}
+	qs.mu.RUnlock()
+
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if qs.byID == nil {
+		qs.byID = make(map[int]Question, len(qs.list))
+		for _, q := range qs.list {
+			qs.byID[q.ID] = q
+		}
+	}
+	return questionsView{list: slices.Clone(qs.list), byID: qs.byID, patterns: qs.patterns}
+}
+
+func (qs *questionSet) find(id int) (Question, bool) {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+	for _, q := range qs.list {
+		if q.ID == id {
+			return q, true
+		}
+	}
+	return Question{}, false
+}
+
+// replace validates list and makes it the active set of questions.
+func (qs *questionSet) replace(list []Question) error {
+	if err := validateQuestions(list); err != nil {
+		return err
+	}
+	patterns, err := compilePatterns(list)
+	if err != nil {
+		return err
+	}
+	if err := validateDefaults(list, patterns); err != nil {
+		return err
+	}
+
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.list = slices.Clone(list)
+	qs.patterns = patterns
+	qs.byID = nil
+	return nil
+}
+
+// add appends q to the set, assigning the next free ID when q.ID is zero.
+func (qs *questionSet) add(q Question) (Question, error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	if q.ID == 0 {
+		q.ID = 1
+		for _, existing := range qs.list {
+			q.ID = max(q.ID, existing.ID+1)
+		}
+	}
+
+	list := append(slices.Clone(qs.list), q)
+	if err := validateQuestions(list); err != nil {
+		return Question{}, err
+	}
+	patterns, err := compilePatterns(list)
+	if err != nil {
+		return Question{}, err
+	}
+	if err := validateDefaults(list, patterns); err != nil {
+		return Question{}, err
+	}
+
+	qs.list = list
+	qs.patterns = patterns
+	qs.byID = nil
+	return q, nil
+}
+
+// update replaces the question with the same ID as q. It reports false when
+// there is no such question.
+func (qs *questionSet) update(q Question) (bool, error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	i := slices.IndexFunc(qs.list, func(existing Question) bool { return existing.ID == q.ID })
+	if i < 0 {
+		return false, nil
+	}
+	list := slices.Clone(qs.list)
+	list[i] = q
+	if err := validateQuestions(list); err != nil {
+		return true, err
+	}
+	patterns, err := compilePatterns(list)
+	if err != nil {
+		return true, err
+	}
+	if err := validateDefaults(list, patterns); err != nil {
+		return true, err
+	}
+
+	qs.list = list
+	qs.patterns = patterns
+	qs.byID = nil
+	return true, nil
+}
+
+func computeETag(list []Question) string {
+	data, err := json.Marshal(list)
+	if err != nil {
+		// Questions are plain data and always encode; fall back to a
+		// value that never matches rather than failing the update.
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func compilePatterns(list []Question) (map[int]*regexp.Regexp, error) {
+	patterns := make(map[int]*regexp.Regexp)
+	for _, q := range list {
+		if q.Validation == nil || q.Validation.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(q.Validation.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("question %d: invalid pattern: %w", q.ID, err)
+		}
+		patterns[q.ID] = re
+	}
+	return patterns, nil
+}
+
+func validateQuestions(list []Question) error {
+	seen := make(map[int]bool, len(list))
+	for _, q := range list {
+		if q.ID <= 0 {
+			return fmt.Errorf("question %q: id must be a positive integer", q.Text.String())
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("question %d: duplicate id", q.ID)
+		}
+		seen[q.ID] = true
+
+		if !slices.Contains(supportedQuestionTypes, q.Type) {
+			return fmt.Errorf("question %d: unsupported type %q", q.ID, q.Type)
+		}
+		if q.Type == "select" || q.Type == "multiselect" {
+			if err := validateOptions(q); err != nil {
+				return fmt.Errorf("question %d: %w", q.ID, err)
+			}
+		}
+		if q.Type == "number" && q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+			return fmt.Errorf("question %d: min must not exceed max", q.ID)
+		}
+		if q.Integer && q.Type != "number" {
+			return fmt.Errorf("question %d: integer is only supported for number questions", q.ID)
+		}
+		if len(q.AllowedHosts) > 0 && q.Type != "url" {
+			return fmt.Errorf("question %d: allowedHosts is only supported for url questions", q.ID)
+		}
+		if slices.ContainsFunc(q.AllowedHosts, func(h string) bool { return strings.TrimPrefix(h, "*.") == "" }) {
+			return fmt.Errorf("question %d: allowedHosts must not contain empty hosts", q.ID)
+		}
+		if q.Type == "file" && len(q.AllowedTypes) == 0 {
+			return fmt.Errorf("question %d: file requires allowedTypes", q.ID)
+		}
+		for option := range q.OptionLabels {
+			if !slices.Contains(q.Options, option) {
+				return fmt.Errorf("question %d: optionLabels refers to unknown option %q", q.ID, option)
+			}
+		}
+		if q.Scoring != nil {
+			if err := validateScoring(q); err != nil {
+				return fmt.Errorf("question %d: %w", q.ID, err)
+			}
+		}
+		if q.MaxFileSize < 0 {
+			return fmt.Errorf("question %d: maxFileSize must not be negative", q.ID)
+		}
+		if q.MaxLength < 0 {
+			return fmt.Errorf("question %d: maxLength must not be negative", q.ID)
+		}
+		if q.Validation != nil && q.Validation.MinLength < 0 {
+			return fmt.Errorf("question %d: minLength must not be negative", q.ID)
+		}
+		if q.Type == "rating" {
+			if err := validateRatingScale(q); err != nil {
+				return fmt.Errorf("question %d: %w", q.ID, err)
+			}
+		}
+		if q.Type == "date" {
+			if err := validateDateBounds(q); err != nil {
+				return fmt.Errorf("question %d: %w", q.ID, err)
+			}
+		}
+	}
+	return validateConditions(list)
+}
+
+// validateDefaults checks that every default is a valid answer to its own
+// question.
+func validateDefaults(list []Question, patterns map[int]*regexp.Regexp) error {
+	for _, q := range list {
+		if q.Default == "" {
+			continue
+		}
+		if err := validateValue(q, patterns[q.ID], q.Default); err != nil {
+			return fmt.Errorf("question %d: invalid default: %w", q.ID, err)
+		}
+	}
+	return nil
+}
+
+// validateConditions checks that every showIf and requiredIf refers to another
+// existing question and that showIf conditions don't form a cycle.
+func validateConditions(list []Question) error {
+	byID := make(map[int]Question, len(list))
+	for _, q := range list {
+		byID[q.ID] = q
+	}
+
+	for _, q := range list {
+		if q.RequiredIf != nil {
+			if _, ok := byID[q.RequiredIf.QuestionID]; !ok || q.RequiredIf.QuestionID == q.ID {
+				return fmt.Errorf("question %d: requiredIf must refer to another existing question", q.ID)
+			}
+		}
+		visited := map[int]bool{q.ID: true}
+		for current := q; current.ShowIf != nil; {
+			ref, ok := byID[current.ShowIf.QuestionID]
+			if !ok {
+				return fmt.Errorf("question %d: showIf refers to unknown question %d", current.ID, current.ShowIf.QuestionID)
+			}
+			if visited[ref.ID] {
+				return fmt.Errorf("question %d: showIf conditions form a cycle", q.ID)
+			}
+			visited[ref.ID] = true
+			current = ref
+		}
+	}
+	return nil
+}
+
+// validateOptions checks that a select or multiselect question has options,
+// none of them blank and no two equal ignoring case, since answers are
+// matched to options case-insensitively.
+func validateOptions(q Question) error {
+	if len(q.Options) == 0 {
+		return fmt.Errorf("%s requires options", q.Type)
+	}
+	seen := make(map[string]bool, len(q.Options))
+	for _, option := range q.Options {
+		if strings.TrimSpace(option) == "" {
+			return errors.New("options must not be empty")
+		}
+		key := strings.ToLower(strings.TrimSpace(option))
+		if seen[key] {
+			return fmt.Errorf("duplicate option %q", option)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func validateRatingScale(q Question) error {
+	if q.Min == nil || q.Max == nil {
+		return errors.New("rating requires min and max")
+	}
+	if *q.Min != math.Trunc(*q.Min) || *q.Max != math.Trunc(*q.Max) {
+		return errors.New("rating bounds must be integers")
+	}
+	if *q.Min > *q.Max {
+		return errors.New("rating min must not exceed max")
+	}
+	return nil
+}
+
+func validateDateBounds(q Question) error {
+	var minDate, maxDate time.Time
+	var err error
+	if q.MinDate != "" {
+		if minDate, err = time.Parse(dateLayout, q.MinDate); err != nil {
+			return fmt.Errorf("minDate must use the %s format", dateLayout)
+		}
+	}
+	if q.MaxDate != "" {
+		if maxDate, err = time.Parse(dateLayout, q.MaxDate); err != nil {
+			return fmt.Errorf("maxDate must use the %s format", dateLayout)
+		}
+	}
+	if q.MinDate != "" && q.MaxDate != "" && minDate.After(maxDate) {
+		return errors.New("minDate must not be after maxDate")
+	}
+	return nil
+}
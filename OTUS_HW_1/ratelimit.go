@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiterIdleTTL is how long an unused client bucket is kept before it is
+// evicted.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a per-client token bucket: each client may make burst
+// requests at once and regains perSecond requests every second.
+type rateLimiter struct {
+	mu        sync.Mutex
+	perSecond float64
+	burst     float64
+	clients   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(max(burst, 1)),
+		clients:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token for key. When none is left it returns false and how long
+// the client should wait before retrying.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now)
+	}
+
+	b, ok := l.clients[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.clients[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.perSecond)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.perSecond * float64(time.Second))
+	return false, wait
+}
+
+// sweep evicts idle clients. The caller must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.clients {
+		if now.Sub(b.last) > rateLimiterIdleTTL {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimit returns a wrapper that rejects clients exceeding perMinute
+// requests with 429. It is a no-op when perMinute is not positive.
+func rateLimit(perMinute, burst int) func(http.HandlerFunc) http.HandlerFunc {
+	if perMinute <= 0 {
+		return func(next http.HandlerFunc) http.HandlerFunc { return next }
+	}
+
+	limiter := newRateLimiter(perMinute, burst)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := limiter.allow(clientKey(clientIP(r)))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, "too many requests, try again later")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// rateLimits gives each kind of respondent request its own budget, so inline
+// checks while typing and file uploads after a submit can't use up the budget
+// of POST /answers itself.
+type rateLimits struct {
+	submit, validate, upload func(http.HandlerFunc) http.HandlerFunc
+}
+
+func newRateLimits(perMinute, burst int) rateLimits {
+	return rateLimits{
+		submit:   rateLimit(perMinute, burst),
+		validate: rateLimit(perMinute, burst),
+		upload:   rateLimit(perMinute, burst),
+	}
+}
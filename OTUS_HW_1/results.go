@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cmp"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// resultsTemplate relies on html/template escaping: answer values come from
+// respondents and must never be rendered as raw HTML.
+var resultsTemplate = template.Must(template.New("results").Parse(`<!doctype html>
+<html lang="ru">
+  <head>
+    <meta charset="UTF-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+    <title>Результаты анкеты</title>
+    <link rel="stylesheet" href="/styles.css" />
+  </head>
+  <body>
+    <main class="container">
+      <h1>Результаты анкеты</h1>
+      <p>Всего ответов: {{.Total}}, полностью заполнено: {{.Completion.Complete}}</p>
+      <p>Заполненность обязательных вопросов: {{printf "%.1f" .Completion.Rate}}%</p>
+      {{range .Questions}}
+      <section class="question">
+        <h2>{{.Text}}</h2>
+        <p>Ответов: {{.Stats.Count}}</p>
+        {{with .Range}}<p>Минимум: {{.Min}}, среднее: {{printf "%.2f" .Avg}}, максимум: {{.Max}}</p>{{end}}
+        {{if .Counts}}
+        <ul>
+          {{range .Counts}}<li>{{.Value}} — {{.Count}}</li>{{end}}
+        </ul>
+        {{end}}
+        {{if .Stats.Recent}}
+        <p>Последние ответы:</p>
+        <ul>
+          {{range .Stats.Recent}}<li>{{.}}</li>{{end}}
+        </ul>
+        {{end}}
+      </section>
+      {{end}}
+    </main>
+  </body>
+</html>
+`))
+
+type valueCount struct {
+	Value string
+	Count int
+}
+
+type numericRange struct {
+	Min, Avg, Max float64
+}
+
+type questionResult struct {
+	Text   string
+	Stats  *questionStats
+	Range  *numericRange
+	Counts []valueCount
+}
+
+func resultsHandler(qs *questionSet, store *answerStore, defaultLocale string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		questions := requestQuestions(r, qs, defaultLocale)
+		subs, err := finalSubmissions(r, store)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		report, err := computeStats(r.Context(), questions, subs)
+		if err != nil {
+			slog.Warn("compute results stopped", "request_id", requestID(r.Context()), "error", err)
+			return
+		}
+
+		view := struct {
+			Total      int
+			Completion completionStats
+			Questions  []questionResult
+		}{Total: len(subs), Completion: report.Completion}
+		for _, q := range questions {
+			st := report.Questions[q.ID]
+			result := questionResult{Text: q.Text.String(), Stats: st}
+			if st.Avg != nil {
+				result.Range = &numericRange{Min: *st.Min, Avg: *st.Avg, Max: *st.Max}
+			}
+			// Free-text questions show recent values instead of counts.
+			if q.Type == "select" || q.Type == "multiselect" || q.Type == "rating" {
+				result.Counts = sortedCounts(result.Stats.Frequencies)
+			}
+			view.Questions = append(view.Questions, result)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := resultsTemplate.Execute(w, view); err != nil {
+			slog.Error("render results", "request_id", requestID(r.Context()), "error", err)
+		}
+	}
+}
+
+func sortedCounts(freq map[string]int) []valueCount {
+	counts := make([]valueCount, 0, len(freq))
+	for value, n := range freq {
+		counts = append(counts, valueCount{Value: value, Count: n})
+	}
+	slices.SortFunc(counts, func(a, b valueCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+	return counts
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaHandler describes a valid AnswersRequest for the current questions as
+// a JSON Schema. It is built on every request, so it follows question edits.
+func schemaHandler(qs *questionSet, defaultLocale string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, answersSchema(requestQuestions(r, qs, defaultLocale)))
+	}
+}
+
+// answersSchema covers what a schema can express: value types, options and
+// bounds, and required questions without showIf. Conditional visibility and
+// date bounds are left to the server. File questions are absent because
+// files are uploaded separately.
+func answersSchema(list []Question) map[string]any {
+	var items []any
+	var required []any
+	for _, q := range list {
+		if q.Type == "file" {
+			continue
+		}
+		items = append(items, map[string]any{
+			"title":    q.Text.String(),
+			"type":     "object",
+			"required": []string{"questionId", "value"},
+			"properties": map[string]any{
+				"questionId": map[string]any{"const": q.ID},
+				"value":      valueSchema(q),
+			},
+			"additionalProperties": false,
+		})
+		if q.Required && q.ShowIf == nil {
+			required = append(required, map[string]any{
+				"contains": map[string]any{
+					"required":   []string{"questionId"},
+					"properties": map[string]any{"questionId": map[string]any{"const": q.ID}},
+				},
+			})
+		}
+	}
+
+	answers := map[string]any{"type": "array", "items": false}
+	if len(items) > 0 {
+		answers["items"] = map[string]any{"oneOf": items}
+	}
+	if len(required) > 0 {
+		answers["allOf"] = required
+	}
+	return map[string]any{
+		"$schema":              jsonSchemaDialect,
+		"title":                "AnswersRequest",
+		"type":                 "object",
+		"required":             []string{"answers"},
+		"properties":           map[string]any{"answers": answers},
+		"additionalProperties": false,
+	}
+}
+
+func valueSchema(q Question) map[string]any {
+	s := map[string]any{}
+	switch q.Type {
+	case "number", "rating":
+		s["type"] = "number"
+		if q.Type == "rating" || q.Integer {
+			s["type"] = "integer"
+		}
+		if q.Min != nil {
+			s["minimum"] = *q.Min
+		}
+		if q.Max != nil {
+			s["maximum"] = *q.Max
+		}
+	case "select":
+		s["type"] = "string"
+		s["enum"] = q.Options
+	case "multiselect":
+		s["type"] = "array"
+		s["items"] = map[string]any{"enum": q.Options}
+		s["minItems"] = 1
+		s["uniqueItems"] = true
+	case "date":
+		s["type"] = "string"
+		s["format"] = "date"
+	default:
+		s["type"] = "string"
+		if q.Type == "email" {
+			s["format"] = "email"
+		}
+		if q.Type == "url" {
+			s["format"] = "uri"
+		}
+		if q.MaxLength > 0 {
+			s["maxLength"] = q.MaxLength
+		}
+		if q.Validation != nil {
+			if q.Validation.MinLength > 0 {
+				s["minLength"] = q.Validation.MinLength
+			}
+			if q.Validation.Pattern != "" {
+				s["pattern"] = q.Validation.Pattern
+			}
+		}
+	}
+	if q.Default != "" {
+		s["default"] = q.Default
+		if n, err := strconv.ParseFloat(q.Default, 64); err == nil && (q.Type == "number" || q.Type == "rating") {
+			s["default"] = n
+		}
+		if chosen, err := parseMultiselect(q.Default); err == nil && q.Type == "multiselect" {
+			s["default"] = chosen
+		}
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ScoringRule turns a question into a quiz item: an answer matching one of
+// Correct earns Points.
+//
+// Text and email answers match ignoring case and surrounding spaces, number
+// and rating answers match numerically, select and date answers must be
+// equal, and a multiselect answer must choose exactly the Correct options.
+type ScoringRule struct {
+	Correct []string `json:"correct"`
+	Points  float64  `json:"points"`
+}
+
+type questionScore struct {
+	QuestionID int     `json:"questionId"`
+	Correct    bool    `json:"correct"`
+	Points     float64 `json:"points"`
+	MaxPoints  float64 `json:"maxPoints"`
+}
+
+type submissionScore struct {
+	SubmissionID int             `json:"submissionId"`
+	Total        float64         `json:"total"`
+	MaxTotal     float64         `json:"maxTotal"`
+	Questions    []questionScore `json:"questions"`
+}
+
+func validateScoring(q Question) error {
+	s := q.Scoring
+	if q.Type == "file" {
+		return errors.New("file questions can't be scored")
+	}
+	if len(s.Correct) == 0 {
+		return errors.New("scoring requires at least one correct value")
+	}
+	if s.Points < 0 || math.IsNaN(s.Points) || math.IsInf(s.Points, 0) {
+		return errors.New("scoring points must be a non-negative number")
+	}
+	for _, correct := range s.Correct {
+		switch q.Type {
+		case "number", "rating":
+			if _, err := strconv.ParseFloat(correct, 64); err != nil {
+				return errors.New("scoring correct values must be numbers")
+			}
+		case "select", "multiselect":
+			if !slices.Contains(q.Options, correct) {
+				return errors.New("scoring correct values must be options")
+			}
+		}
+	}
+	return nil
+}
+
+// isCorrect reports whether value earns the points of q.Scoring.
+func isCorrect(q Question, value string) bool {
+	if value == "" {
+		return false
+	}
+	correct := q.Scoring.Correct
+	switch q.Type {
+	case "text", "email":
+		value = strings.TrimSpace(value)
+		return slices.ContainsFunc(correct, func(c string) bool { return strings.EqualFold(strings.TrimSpace(c), value) })
+	case "number", "rating":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		return slices.ContainsFunc(correct, func(c string) bool {
+			expected, err := strconv.ParseFloat(c, 64)
+			return err == nil && expected == n
+		})
+	case "multiselect":
+		chosen, err := parseMultiselect(value)
+		if err != nil || len(chosen) != len(correct) {
+			return false
+		}
+		for _, c := range correct {
+			if !slices.Contains(chosen, c) {
+				return false
+			}
+		}
+		return true
+	}
+	return slices.Contains(correct, value)
+}
+
+// scoreSubmission sums the points sub earns on the scored questions of list.
+// Questions without scoring are left out of the breakdown. It reports false
+// when no question is scored.
+func scoreSubmission(list []Question, sub StoredSubmission) (submissionScore, bool) {
+	values := answerValues(sub.Answers)
+	score := submissionScore{SubmissionID: sub.ID, Questions: []questionScore{}}
+	for _, q := range list {
+		if q.Scoring == nil {
+			continue
+		}
+		result := questionScore{QuestionID: q.ID, MaxPoints: q.Scoring.Points}
+		if isCorrect(q, values[q.ID]) {
+			result.Correct = true
+			result.Points = q.Scoring.Points
+		}
+		score.Total += result.Points
+		score.MaxTotal += result.MaxPoints
+		score.Questions = append(score.Questions, result)
+	}
+	return score, len(score.Questions) > 0
+}
+
+func scoreHandler(qs *questionSet, store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid submission id")
+			return
+		}
+		sub, ok := store.get(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "submission not found")
+			return
+		}
+		list := qs.all()
+		sortByOrder(list)
+		score, scored := scoreSubmission(list, sub)
+		if !scored {
+			writeError(w, http.StatusNotFound, "the survey has no scored questions")
+			return
+		}
+		writeJSON(w, http.StatusOK, score)
+	}
+}
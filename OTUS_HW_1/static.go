@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// spaFallback serves index.html for paths that don't exist under dir, so
+// client-side routes of a single-page app survive a reload. Paths with a file
+// extension are treated as assets and still get a real 404.
+func spaFallback(dir string, files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if path.Ext(name) == "" {
+			_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+			if errors.Is(err, os.ErrNotExist) {
+				r = r.Clone(r.Context())
+				r.URL.Path = "/"
+				r.URL.RawPath = ""
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// apiPathPrefixes are the unversioned path segments that look like API calls,
+// including singular typos of the resource names. /admin is left out: it was
+// never an unversioned API path, and a frontend may route its pages there.
+var apiPathPrefixes = []string{"/question", "/questions", "/answer", "/answers", "/stats", "/results", "/survey", "/surveys"}
+
+// withAPINotFound answers API-like paths that match no route, such as
+// /question or /stats/today, with the API's JSON 404 instead of the file
+// server's response or, in SPA mode, index.html. Prefixes match whole path
+// segments, and paths that exist under dir are always passed to files.
+func withAPINotFound(dir string, files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		apiLike := slices.ContainsFunc(apiPathPrefixes, func(prefix string) bool {
+			return name == prefix || strings.HasPrefix(name, prefix+"/")
+		})
+		if apiLike {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); errors.Is(err, os.ErrNotExist) {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("no API endpoint at %s", r.URL.Path))
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -1,10 +1,15 @@
 const form = document.getElementById("survey-form");
 const statusNode = document.getElementById("status");
+let currentQuestions = [];
+
+// ?survey=<id> opens one of the additional surveys instead of the default one.
+const surveyId = new URLSearchParams(window.location.search).get("survey");
+const apiBase = surveyId ? `/v1/surveys/${encodeURIComponent(surveyId)}` : "/v1";
 
 async function loadQuestions() {
   statusNode.textContent = "Загрузка вопросов...";
   try {
-    const response = await fetch("/questions");
+    const response = await fetch(`${apiBase}/questions`);
     if (!response.ok) {
       throw new Error("Не удалось получить вопросы");
     }
@@ -20,7 +25,19 @@ async function loadQuestions() {
 function renderQuestions(questions) {
   form.innerHTML = "";
 
+  const withSections = questions.some((question) => question.section);
+  let currentSection = null;
+
   questions.forEach((question) => {
+    const section = question.section || "General";
+    if (withSections && section !== currentSection) {
+      const heading = document.createElement("h2");
+      heading.className = "section-title";
+      heading.textContent = section;
+      form.appendChild(heading);
+      currentSection = section;
+    }
+
     const wrapper = document.createElement("div");
     wrapper.className = "question";
 
@@ -28,38 +45,159 @@ function renderQuestions(questions) {
     label.setAttribute("for", `q-${question.id}`);
     label.textContent = question.text;
 
-    const input = document.createElement("input");
+    const input = createInput(question);
     input.id = `q-${question.id}`;
     input.name = String(question.id);
-    input.type = question.type === "number" ? "number" : "text";
-    input.required = true;
+    input.required = Boolean(question.required);
 
     wrapper.append(label, input);
     form.appendChild(wrapper);
   });
 
+  currentQuestions = questions;
+  updateVisibility();
+
   const submitButton = document.createElement("button");
   submitButton.type = "submit";
   submitButton.textContent = "Отправить";
   form.appendChild(submitButton);
 }
 
+// Hides questions whose showIf condition is not met and marks questions
+// required while their requiredIf condition holds. Hidden inputs are disabled
+// so they are neither validated nor submitted.
+function updateVisibility() {
+  const byId = new Map(currentQuestions.map((question) => [question.id, question]));
+
+  const conditionMet = (condition) => {
+    const parent = byId.get(condition.questionId);
+    const parentInput = document.getElementById(`q-${condition.questionId}`);
+    if (!parent || !parentInput || !isVisible(parent)) return false;
+    if (parent.type === "multiselect") {
+      return Array.from(parentInput.selectedOptions).some((option) => option.value === condition.value);
+    }
+    return parentInput.value === condition.value;
+  };
+  const isVisible = (question) => !question.showIf || conditionMet(question.showIf);
+
+  currentQuestions.forEach((question) => {
+    const input = document.getElementById(`q-${question.id}`);
+    const visible = isVisible(question);
+    input.closest(".question").hidden = !visible;
+    input.disabled = !visible;
+    input.required = Boolean(question.required) || Boolean(question.requiredIf && conditionMet(question.requiredIf));
+  });
+}
+
+function createInput(question) {
+  if (question.type === "select") {
+    return createSelect(question.options || [], question.default, question.optionLabels);
+  }
+
+  if (question.type === "multiselect") {
+    const select = document.createElement("select");
+    select.multiple = true;
+    (question.options || []).forEach((optionValue) => {
+      const option = document.createElement("option");
+      option.value = optionValue;
+      option.textContent = optionLabel(question.optionLabels, optionValue);
+      select.appendChild(option);
+    });
+    return select;
+  }
+
+  if (question.type === "rating") {
+    const scale = [];
+    for (let value = question.min; value <= question.max; value += 1) {
+      scale.push(String(value));
+    }
+    return createSelect(scale, question.default);
+  }
+
+  const input = document.createElement("input");
+  if (question.type === "file") {
+    input.type = "file";
+    input.accept = (question.allowedTypes || []).join(",");
+    return input;
+  }
+  input.type = ["number", "email", "date", "url"].includes(question.type) ? question.type : "text";
+  // defaultValue survives form.reset() after a successful submit.
+  if (question.default) input.defaultValue = question.default;
+  if (question.type === "number") {
+    // Without step="any" the browser rejects decimals.
+    input.step = question.integer ? "1" : "any";
+    if (question.min !== undefined) input.min = String(question.min);
+    if (question.max !== undefined) input.max = String(question.max);
+  }
+  if (question.maxLength) {
+    input.maxLength = question.maxLength;
+  }
+  if (question.type === "date") {
+    if (question.minDate) input.min = question.minDate;
+    if (question.maxDate) input.max = question.maxDate;
+  }
+  return input;
+}
+
+// optionLabel returns the translated label of an option, which the server
+// picks from the browser's Accept-Language.
+function optionLabel(labels, value) {
+  return (labels && labels[value]) || value;
+}
+
+function createSelect(values, defaultValue, labels) {
+  const select = document.createElement("select");
+
+  const placeholder = document.createElement("option");
+  placeholder.value = "";
+  placeholder.textContent = "Выберите вариант";
+  select.appendChild(placeholder);
+
+  values.forEach((optionValue) => {
+    const option = document.createElement("option");
+    option.value = optionValue;
+    option.textContent = optionLabel(labels, optionValue);
+    option.defaultSelected = optionValue === defaultValue;
+    select.appendChild(option);
+  });
+  return select;
+}
+
+form.addEventListener("input", updateVisibility);
+
 form.addEventListener("submit", async (event) => {
   event.preventDefault();
   statusNode.textContent = "";
 
   const formData = new FormData(form);
   const answers = [];
+  const files = [];
+  const multiselect = new Map();
+  const types = new Map(currentQuestions.map((question) => [String(question.id), question.type]));
 
   for (const [questionId, value] of formData.entries()) {
+    // Files are uploaded separately once the submission has an id.
+    if (value instanceof File) {
+      if (value.name) files.push({ questionId, file: value });
+      continue;
+    }
+    // Multiselect answers are sent as a JSON array of the chosen options.
+    if (types.get(questionId) === "multiselect") {
+      multiselect.set(questionId, [...(multiselect.get(questionId) || []), String(value)]);
+      continue;
+    }
     answers.push({
       questionId: Number(questionId),
       value: String(value),
     });
   }
 
+  for (const [questionId, chosen] of multiselect) {
+    answers.push({ questionId: Number(questionId), value: JSON.stringify(chosen) });
+  }
+
   try {
-    const response = await fetch("/answers", {
+    const response = await fetch(`${apiBase}/answers`, {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
@@ -68,14 +206,35 @@ form.addEventListener("submit", async (event) => {
     });
 
     if (!response.ok) {
-      throw new Error("Ошибка отправки");
+      throw new Error(await errorMessage(response));
+    }
+
+    const { id, uploadToken } = await response.json();
+    for (const { questionId, file } of files) {
+      const upload = new FormData();
+      upload.append("file", file);
+      const uploadResponse = await fetch(`${apiBase}/answers/${id}/files/${questionId}`, {
+        method: "POST",
+        headers: { "X-Upload-Token": uploadToken },
+        body: upload,
+      });
+      if (!uploadResponse.ok) {
+        throw new Error(await errorMessage(uploadResponse));
+      }
     }
 
     statusNode.textContent = "Спасибо!";
     form.reset();
+    updateVisibility();
   } catch (error) {
-    statusNode.textContent = "Не удалось отправить ответы";
+    statusNode.textContent = `Не удалось отправить ответы: ${error.message}`;
   }
 });
 
+async function errorMessage(response) {
+  const body = await response.json().catch(() => null);
+  const messages = (body?.errors || []).map((item) => item.message);
+  return messages.join("; ") || "Ошибка отправки";
+}
+
 loadQuestions();
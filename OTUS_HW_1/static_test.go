@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPINotFoundKeepsStaticFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"index.html": "<html>app</html>", "admin.css": "body{}"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := withAPINotFound(dir, spaFallback(dir, http.FileServer(http.Dir(dir))))
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/admin.css", http.StatusOK, "text/css", "body{}"},
+		{"/admin/dashboard", http.StatusOK, "text/html", "<html>app</html>"},
+		{"/question", http.StatusNotFound, "application/json", "no API endpoint"},
+		{"/stats/today", http.StatusNotFound, "application/json", "no API endpoint"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+			t.Errorf("GET %s: Content-Type = %q, want %s", tt.path, ct, tt.contentType)
+		}
+		if !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("GET %s: body = %q, want it to contain %q", tt.path, rec.Body, tt.body)
+		}
+	}
+}
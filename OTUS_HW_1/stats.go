@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type questionStats struct {
+	QuestionID  int            `json:"questionId"`
+	Type        string         `json:"type"`
+	Count       int            `json:"count"`
+	Frequencies map[string]int `json:"frequencies,omitempty"`
+	Min         *float64       `json:"min,omitempty"`
+	Avg         *float64       `json:"avg,omitempty"`
+	Max         *float64       `json:"max,omitempty"`
+	Recent      []string       `json:"recent,omitempty"`
+}
+
+// completionStats shows how many of the applicable required questions
+// respondents actually answered.
+type completionStats struct {
+	Submissions      int     `json:"submissions"`
+	Complete         int     `json:"complete"`
+	RequiredAnswered int     `json:"requiredAnswered"`
+	RequiredTotal    int     `json:"requiredTotal"`
+	Rate             float64 `json:"rate"`
+}
+
+type statsReport struct {
+	Questions  map[int]*questionStats `json:"questions"`
+	Completion completionStats        `json:"completion"`
+}
+
+// recentValuesLimit is how many of the latest free-text values are kept in
+// the statistics.
+const recentValuesLimit = 5
+
+// computeStats aggregates answers per question. It stops early with the
+// context error when ctx is done.
+func computeStats(ctx context.Context, qs []Question, subs []StoredSubmission) (*statsReport, error) {
+	stats := make(map[int]*questionStats, len(qs))
+	sums := make(map[int]float64)
+	for _, q := range qs {
+		st := &questionStats{QuestionID: q.ID, Type: q.Type}
+		if q.Type == "text" || q.Type == "select" || q.Type == "multiselect" || q.Type == "rating" {
+			st.Frequencies = make(map[string]int)
+		}
+		stats[q.ID] = st
+	}
+
+	byID := make(map[int]Question, len(qs))
+	for _, q := range qs {
+		byID[q.ID] = q
+	}
+
+	var completion completionStats
+	for _, sub := range subs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		answered, total := requiredCompletion(byID, sub)
+		completion.Submissions++
+		completion.RequiredAnswered += answered
+		completion.RequiredTotal += total
+		if answered == total {
+			completion.Complete++
+		}
+
+		for _, a := range sub.Answers {
+			st, ok := stats[a.QuestionID]
+			if !ok || a.Value == "" {
+				continue
+			}
+
+			if st.Type == "number" || st.Type == "rating" {
+				n, err := strconv.ParseFloat(a.Value, 64)
+				if err != nil {
+					continue
+				}
+				if st.Min == nil || n < *st.Min {
+					st.Min = ptr(n)
+				}
+				if st.Max == nil || n > *st.Max {
+					st.Max = ptr(n)
+				}
+				sums[a.QuestionID] += n
+			}
+			// Every chosen option of a multiselect answer counts separately.
+			if st.Type == "multiselect" {
+				chosen, _ := parseMultiselect(a.Value)
+				for _, item := range chosen {
+					st.Frequencies[item]++
+				}
+			} else if st.Frequencies != nil {
+				st.Frequencies[a.Value]++
+			}
+			if st.Type == "text" || st.Type == "email" || st.Type == "url" {
+				st.Recent = append(st.Recent, a.Value)
+				if len(st.Recent) > recentValuesLimit {
+					st.Recent = st.Recent[1:]
+				}
+			}
+			st.Count++
+		}
+	}
+
+	for id, sum := range sums {
+		st := stats[id]
+		st.Avg = ptr(sum / float64(st.Count))
+	}
+
+	completion.Rate = 100
+	if completion.RequiredTotal > 0 {
+		completion.Rate = 100 * float64(completion.RequiredAnswered) / float64(completion.RequiredTotal)
+	}
+	return &statsReport{Questions: stats, Completion: completion}, nil
+}
+
+// requiredCompletion counts the required questions that apply to sub and how
+// many of them it answered. Questions hidden by showIf don't count, and
+// questions with requiredIf count only while the condition holds.
+func requiredCompletion(byID map[int]Question, sub StoredSubmission) (answered, total int) {
+	values := answerValues(sub.Answers)
+	for _, q := range byID {
+		if !isRequired(q, byID, values) || !isVisible(q, byID, values) {
+			continue
+		}
+		total++
+		if _, ok := values[q.ID]; ok {
+			answered++
+		}
+	}
+	return answered, total
+}
+
+func statsHandler(qs *questionSet, store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subs, err := finalSubmissions(r, store)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		stats, err := computeStats(r.Context(), qs.all(), subs)
+		if err != nil {
+			slog.Warn("compute stats stopped", "request_id", requestID(r.Context()), "error", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,740 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type answerStore struct {
+	mu      sync.RWMutex
+	answers []StoredSubmission
+	nextID  int
+	path    string
+
+	// dedupWindow is how long a submission blocks identical ones; zero
+	// disables the check. recent maps answer hashes to those submissions.
+	dedupWindow time.Duration
+	recent      map[string]recentSubmission
+
+	// idempotencyTTL is how long an Idempotency-Key is remembered; zero
+	// disables keys. keys maps them to the submissions they created.
+	idempotencyTTL time.Duration
+	keys           map[string]idempotentRequest
+
+	// submissionCap is how many submissions one client may create; zero
+	// disables the cap. clients counts them by clientKey and is persisted to
+	// clientsPath, next to the answers file.
+	submissionCap int
+	clients       map[string]int
+	clientsPath   string
+
+	// subscribers receive every newly stored submission.
+	subscribers map[chan StoredSubmission]struct{}
+}
+
+type recentSubmission struct {
+	id int
+	at time.Time
+}
+
+// duplicateSubmissionError is returned by save when the same client sent the
+// same final answers within the dedup window. Drafts are not deduplicated.
+type duplicateSubmissionError struct {
+	ID int
+}
+
+func (e *duplicateSubmissionError) Error() string {
+	return fmt.Sprintf("duplicate of submission %d", e.ID)
+}
+
+type idempotentRequest struct {
+	id   int
+	hash string
+	at   time.Time
+}
+
+// replayedSubmissionError is returned by save when the Idempotency-Key was
+// already used for the same request. Sub is the submission it created.
+type replayedSubmissionError struct {
+	Sub StoredSubmission
+}
+
+func (e *replayedSubmissionError) Error() string {
+	return fmt.Sprintf("idempotency key already used for submission %d", e.Sub.ID)
+}
+
+// errIdempotencyKeyReused is returned by save when the Idempotency-Key was
+// already used for a request with different answers.
+var errIdempotencyKeyReused = errors.New("idempotency key was already used with different answers")
+
+// errSubmissionCapReached is returned by save when the client already created
+// as many submissions as the cap allows.
+var errSubmissionCapReached = errors.New("submission limit for this client reached")
+
+// newAnswerStore creates a store backed by the file at path. An empty path
+// keeps answers in memory only. A positive dedupWindow makes save reject
+// answers identical to a submission stored that recently, and a positive
+// idempotencyTTL makes it remember idempotency keys for that long. A positive
+// submissionCap limits how many submissions save accepts from one client.
+func newAnswerStore(path string, dedupWindow, idempotencyTTL time.Duration, submissionCap int) (*answerStore, error) {
+	s := &answerStore{
+		answers:        make([]StoredSubmission, 0),
+		nextID:         1,
+		path:           path,
+		dedupWindow:    dedupWindow,
+		recent:         make(map[string]recentSubmission),
+		idempotencyTTL: idempotencyTTL,
+		keys:           make(map[string]idempotentRequest),
+		submissionCap:  submissionCap,
+		clients:        make(map[string]int),
+		subscribers:    make(map[chan StoredSubmission]struct{}),
+	}
+	if path == "" {
+		return s, nil
+	}
+	s.clientsPath = strings.TrimSuffix(path, ".json") + ".clients.json"
+	if err := s.loadClients(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read answers file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.answers); err != nil {
+		return nil, fmt.Errorf("parse answers file %s: %w", path, err)
+	}
+	if s.answers == nil {
+		s.answers = make([]StoredSubmission, 0)
+	}
+
+	for _, sub := range s.answers {
+		if sub.ID >= s.nextID {
+			s.nextID = sub.ID + 1
+		}
+	}
+	// Files written before submissions had IDs decode with ID 0, and those
+	// written before drafts existed have no status.
+	for i := range s.answers {
+		if s.answers[i].ID == 0 {
+			s.answers[i].ID = s.nextID
+			s.nextID++
+		}
+		if s.answers[i].Status == "" {
+			s.answers[i].Status = statusFinal
+		}
+	}
+	return s, nil
+}
+
+// save stores a new submission with the given status. Drafts get a fresh
+// DraftToken. client identifies the sender for deduplication, so identical
+// answers from different people are not mistaken for a retry. A non-empty key
+// is an Idempotency-Key: repeating it returns the original submission instead
+// of storing a new one. meta is stored with the submission as is. With
+// uploads set the submission gets an UploadToken.
+func (s *answerStore) save(req AnswersRequest, status, client, key string, meta submissionMeta, uploads bool) (StoredSubmission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	var requestHash string
+	if key != "" && s.idempotencyTTL > 0 {
+		for k, r := range s.keys {
+			if now.Sub(r.at) >= s.idempotencyTTL {
+				delete(s.keys, k)
+			}
+		}
+		requestHash = status + " " + answersHash(req.Answers)
+		if r, ok := s.keys[key]; ok {
+			if r.hash != requestHash {
+				return StoredSubmission{}, errIdempotencyKeyReused
+			}
+			if i := slices.IndexFunc(s.answers, func(sub StoredSubmission) bool { return sub.ID == r.id }); i >= 0 {
+				return StoredSubmission{}, &replayedSubmissionError{Sub: s.answers[i]}
+			}
+		}
+	}
+
+	var hash string
+	if s.dedupWindow > 0 && status == statusFinal {
+		for h, r := range s.recent {
+			if now.Sub(r.at) >= s.dedupWindow {
+				delete(s.recent, h)
+			}
+		}
+		hash = client + " " + answersHash(req.Answers)
+		if r, ok := s.recent[hash]; ok {
+			return StoredSubmission{}, &duplicateSubmissionError{ID: r.id}
+		}
+	}
+
+	// The count is persisted before the submission, so a failure in between
+	// can only overcount.
+	var counted string
+	if s.submissionCap > 0 {
+		counted = clientKey(client)
+		if s.clients[counted] >= s.submissionCap {
+			return StoredSubmission{}, errSubmissionCapReached
+		}
+		s.clients[counted]++
+		if err := s.persistClients(); err != nil {
+			s.uncount(counted)
+			return StoredSubmission{}, err
+		}
+	}
+
+	sub := StoredSubmission{ID: s.nextID, Status: status, SubmittedAt: now, Answers: req.Answers, UserAgent: meta.UserAgent, Referer: meta.Referer}
+	if status == statusDraft {
+		token, err := newToken()
+		if err != nil {
+			s.uncount(counted)
+			return StoredSubmission{}, err
+		}
+		sub.DraftToken = token
+	}
+	if uploads {
+		token, err := newToken()
+		if err != nil {
+			s.uncount(counted)
+			return StoredSubmission{}, err
+		}
+		sub.UploadToken = token
+	}
+	s.answers = append(s.answers, sub)
+	if err := s.persist(); err != nil {
+		s.answers = s.answers[:len(s.answers)-1]
+		s.uncount(counted)
+		return StoredSubmission{}, err
+	}
+	s.nextID++
+	if hash != "" {
+		s.recent[hash] = recentSubmission{id: sub.ID, at: now}
+	}
+	if requestHash != "" {
+		s.keys[key] = idempotentRequest{id: sub.ID, hash: requestHash, at: now}
+	}
+	s.publish(sub)
+	return sub, nil
+}
+
+// uncount takes back a submission counted for key after saving it failed.
+// The caller must hold s.mu.
+func (s *answerStore) uncount(key string) {
+	if key == "" {
+		return
+	}
+	s.clients[key]--
+	if s.clients[key] <= 0 {
+		delete(s.clients, key)
+	}
+}
+
+// subscriberBuffer is how many submissions a subscriber may fall behind
+// before further ones are dropped for it.
+const subscriberBuffer = 16
+
+// subscribe registers a channel that receives new submissions. The returned
+// function unregisters it and must be called once the caller is done.
+func (s *answerStore) subscribe() (<-chan StoredSubmission, func()) {
+	ch := make(chan StoredSubmission, subscriberBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}
+}
+
+// closeSubscribers closes every subscriber channel, ending open streams.
+func (s *answerStore) closeSubscribers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		close(ch)
+		delete(s.subscribers, ch)
+	}
+}
+
+// publish hands sub to every subscriber without blocking; slow subscribers
+// miss it. The caller must hold s.mu.
+func (s *answerStore) publish(sub StoredSubmission) {
+	for ch := range s.subscribers {
+		select {
+		case ch <- sub.clone():
+		default:
+		}
+	}
+}
+
+// newToken returns a random secret for draft and upload tokens.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// answersHash identifies a set of answers regardless of their order. Empty
+// values are ignored, as they are during validation.
+func answersHash(answers []Answer) string {
+	normalized := make([]Answer, 0, len(answers))
+	for _, a := range answers {
+		if a.Value != "" {
+			normalized = append(normalized, a)
+		}
+	}
+	slices.SortStableFunc(normalized, func(a, b Answer) int { return a.QuestionID - b.QuestionID })
+
+	h := sha256.New()
+	for _, a := range normalized {
+		fmt.Fprintf(h, "%d:%q\n", a.QuestionID, a.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// importRejection explains why an imported submission was not stored.
+type importRejection struct {
+	Index  int        `json:"index"`
+	ID     int        `json:"id,omitempty"`
+	Errors []apiError `json:"errors"`
+}
+
+// importAll appends already validated submissions under a single lock and
+// persists once. Submissions without an ID get the next free one, and those
+// without a timestamp get the current time. Submissions whose ID is already
+// taken are rejected; indexes are reported relative to subs.
+func (s *answerStore) importAll(subs []StoredSubmission, indexes []int) ([]StoredSubmission, []importRejection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taken := make(map[int]bool, len(s.answers)+len(subs))
+	for _, existing := range s.answers {
+		taken[existing.ID] = true
+	}
+
+	var rejected []importRejection
+	imported := make([]StoredSubmission, 0, len(subs))
+	nextID := s.nextID
+	now := time.Now().UTC()
+	for i, sub := range subs {
+		if sub.ID != 0 && taken[sub.ID] {
+			rejected = append(rejected, importRejection{
+				Index:  indexes[i],
+				ID:     sub.ID,
+				Errors: []apiError{{Message: "submission id is already taken"}},
+			})
+			continue
+		}
+		if sub.ID != 0 {
+			taken[sub.ID] = true
+			nextID = max(nextID, sub.ID+1)
+		}
+		if sub.SubmittedAt.IsZero() {
+			sub.SubmittedAt = now
+		}
+		if sub.Status == "" {
+			sub.Status = statusFinal
+		}
+		imported = append(imported, sub.clone())
+	}
+	for i := range imported {
+		if imported[i].ID == 0 {
+			for taken[nextID] {
+				nextID++
+			}
+			imported[i].ID = nextID
+			taken[nextID] = true
+			nextID++
+		}
+	}
+
+	previous := s.answers
+	s.answers = append(slices.Clone(s.answers), imported...)
+	if err := s.persist(); err != nil {
+		s.answers = previous
+		return nil, nil, err
+	}
+	s.nextID = nextID
+	for _, sub := range imported {
+		s.publish(sub)
+	}
+	return imported, rejected, nil
+}
+
+// draftToken returns the token of the draft with the given id, or "" when there
+// is no such draft.
+func (s *answerStore) draftToken(id int) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sub := range s.answers {
+		if sub.ID == id && sub.Status == statusDraft {
+			return sub.DraftToken
+		}
+	}
+	return ""
+}
+
+// uploadToken returns the upload token of the submission with the given id,
+// or "" when there is no such submission or it has no token.
+func (s *answerStore) uploadToken(id int) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sub := range s.answers {
+		if sub.ID == id {
+			return sub.UploadToken
+		}
+	}
+	return ""
+}
+
+// snapshot returns a deep copy of all submissions, so callers can encode or
+// aggregate them without holding the lock or racing with later writes.
+func (s *answerStore) snapshot() []StoredSubmission {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneSubmissions(s.answers)
+}
+
+// page returns up to limit submissions starting at offset in submission time
+// order, plus the total number of submissions. When match is not nil, only
+// the submissions it accepts are paged and counted.
+func (s *answerStore) page(offset, limit int, desc bool, match func(StoredSubmission) bool) ([]StoredSubmission, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ordered := slices.Clone(s.answers)
+	if match != nil {
+		ordered = slices.DeleteFunc(ordered, func(sub StoredSubmission) bool { return !match(sub) })
+	}
+	slices.SortStableFunc(ordered, func(a, b StoredSubmission) int {
+		if desc {
+			return b.SubmittedAt.Compare(a.SubmittedAt)
+		}
+		return a.SubmittedAt.Compare(b.SubmittedAt)
+	})
+
+	total := len(ordered)
+	start := min(offset, total)
+	end := min(start+limit, total)
+	return cloneSubmissions(ordered[start:end]), total
+}
+
+// pageAfter returns up to limit submissions that follow the one with ID after
+// in ID order, the total number of submissions and whether more follow the
+// page. IDs only grow, so new submissions never shift the pages. An after of
+// 0 starts from the first submission. match filters like in page.
+func (s *answerStore) pageAfter(after, limit int, desc bool, match func(StoredSubmission) bool) ([]StoredSubmission, int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ordered := slices.Clone(s.answers)
+	if match != nil {
+		ordered = slices.DeleteFunc(ordered, func(sub StoredSubmission) bool { return !match(sub) })
+	}
+	slices.SortFunc(ordered, func(a, b StoredSubmission) int {
+		if desc {
+			return b.ID - a.ID
+		}
+		return a.ID - b.ID
+	})
+
+	total := len(ordered)
+	start := 0
+	if after > 0 {
+		start = slices.IndexFunc(ordered, func(sub StoredSubmission) bool {
+			if desc {
+				return sub.ID < after
+			}
+			return sub.ID > after
+		})
+		if start < 0 {
+			start = total
+		}
+	}
+	end := min(start+limit, total)
+	return cloneSubmissions(ordered[start:end]), total, end < total
+}
+
+func (s *answerStore) count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.answers)
+}
+
+// countMatching counts the submissions match accepts without copying them.
+func (s *answerStore) countMatching(match func(StoredSubmission) bool) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, sub := range s.answers {
+		if match(sub) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *answerStore) get(id int) (StoredSubmission, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sub := range s.answers {
+		if sub.ID == id {
+			return sub.clone(), true
+		}
+	}
+	return StoredSubmission{}, false
+}
+
+// setAnswer sets the answer to a.QuestionID in the submission with the given
+// id, replacing an earlier answer to the same question. It reports false when
+// no such submission exists.
+func (s *answerStore) setAnswer(id int, a Answer) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.answers, func(sub StoredSubmission) bool { return sub.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+
+	updated := s.answers[i].clone()
+	updated.Answers = slices.DeleteFunc(updated.Answers, func(existing Answer) bool { return existing.QuestionID == a.QuestionID })
+	updated.Answers = append(updated.Answers, a)
+
+	previous := s.answers
+	s.answers = slices.Clone(s.answers)
+	s.answers[i] = updated
+	if err := s.persist(); err != nil {
+		s.answers = previous
+		return false, err
+	}
+	return true, nil
+}
+
+// replaceAll swaps every stored submission for subs, which must have unique
+// IDs. The store is left unchanged when persisting fails.
+func (s *answerStore) replaceAll(subs []StoredSubmission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nextID := 1
+	for _, sub := range subs {
+		nextID = max(nextID, sub.ID+1)
+	}
+
+	previous := s.answers
+	s.answers = cloneSubmissions(subs)
+	if err := s.persist(); err != nil {
+		s.answers = previous
+		return err
+	}
+	s.nextID = nextID
+	clear(s.recent)
+	clear(s.keys)
+	return nil
+}
+
+// reset deletes every submission and returns them. IDs start from 1 again.
+func (s *answerStore) reset() ([]StoredSubmission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.answers
+	s.answers = make([]StoredSubmission, 0)
+	if err := s.persist(); err != nil {
+		s.answers = previous
+		return nil, err
+	}
+	s.nextID = 1
+	clear(s.recent)
+	clear(s.keys)
+	clear(s.clients)
+	if err := s.persistClients(); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// update replaces the answers and status of the submission with the given
+// id, keeping the earlier answers for which keep returns true. ID and
+// SubmittedAt stay the same and ModifiedAt is set to the current time. It
+// reports false when no such submission exists.
+func (s *answerStore) update(id int, answers []Answer, status string, keep func(Answer) bool) (StoredSubmission, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.answers, func(sub StoredSubmission) bool { return sub.ID == id })
+	if i < 0 {
+		return StoredSubmission{}, false, nil
+	}
+
+	updated := s.answers[i].clone()
+	kept := slices.DeleteFunc(updated.Answers, func(a Answer) bool { return !keep(a) })
+	updated.Answers = append(slices.Clone(answers), kept...)
+	updated.ModifiedAt = ptr(time.Now().UTC())
+	updated.Status = status
+	if status == statusFinal {
+		updated.DraftToken = ""
+	}
+
+	previous := s.answers
+	s.answers = slices.Clone(s.answers)
+	s.answers[i] = updated
+	if err := s.persist(); err != nil {
+		s.answers = previous
+		return StoredSubmission{}, false, err
+	}
+	return updated.clone(), true, nil
+}
+
+// delete removes the submission with the given id. It reports false when no
+// such submission exists.
+func (s *answerStore) delete(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.answers, func(sub StoredSubmission) bool { return sub.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+
+	previous := s.answers
+	s.answers = slices.Delete(slices.Clone(s.answers), i, i+1)
+	if err := s.persist(); err != nil {
+		s.answers = previous
+		return false, err
+	}
+	for h, r := range s.recent {
+		if r.id == id {
+			delete(s.recent, h)
+		}
+	}
+	for k, r := range s.keys {
+		if r.id == id {
+			delete(s.keys, k)
+		}
+	}
+	return true, nil
+}
+
+// setAnswerKinds sets the JSON encoding of every stored answer from the
+// question types in byID. It changes encoding only, so nothing is persisted.
+func (s *answerStore) setAnswerKinds(byID map[int]Question) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.answers {
+		s.answers[i].Answers = slices.Clone(s.answers[i].Answers)
+		setAnswerKinds(byID, s.answers[i].Answers)
+	}
+}
+
+// checkWritable verifies that the answers file directory accepts new files.
+// It is a no-op for in-memory stores.
+func (s *answerStore) checkWritable() error {
+	if s.path == "" {
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("answers directory is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// persist writes the full answers slice to disk. The caller must hold s.mu.
+func (s *answerStore) persist() error {
+	if s.path == "" {
+		return nil
+	}
+	return writeJSONFile(s.path, "answers", s.answers)
+}
+
+func (s *answerStore) loadClients() error {
+	data, err := os.ReadFile(s.clientsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read client counts file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.clients); err != nil {
+		return fmt.Errorf("parse client counts file %s: %w", s.clientsPath, err)
+	}
+	if s.clients == nil {
+		s.clients = make(map[string]int)
+	}
+	return nil
+}
+
+// persistClients writes the submission counts per client to disk. The caller
+// must hold s.mu.
+func (s *answerStore) persistClients() error {
+	if s.clientsPath == "" {
+		return nil
+	}
+	return writeJSONFile(s.clientsPath, "client counts", s.clients)
+}
+
+// writeJSONFile replaces the file at path with v encoded as JSON. The data is
+// written to a temporary file first, so readers never see a partial file.
+// name describes the file in error messages.
+func writeJSONFile(path, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp %s file: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s file: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync %s file: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close %s file: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace %s file: %w", name, err)
+	}
+	return nil
+}
+
+func (sub StoredSubmission) clone() StoredSubmission {
+	sub.Answers = slices.Clone(sub.Answers)
+	return sub
+}
+
+func cloneSubmissions(subs []StoredSubmission) []StoredSubmission {
+	result := make([]StoredSubmission, len(subs))
+	for i, sub := range subs {
+		result[i] = sub.clone()
+	}
+	return result
+}
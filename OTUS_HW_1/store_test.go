@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestStoreConcurrentSaveAndSnapshot is meant for go test -race: snapshots
+// must not share memory with the store, even while saves reallocate it.
+func TestStoreConcurrentSaveAndSnapshot(t *testing.T) {
+	store, err := newAnswerStore("", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, readers, perWriter = 4, 4, 200
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				req := AnswersRequest{Answers: []Answer{{QuestionID: 1, Value: strconv.Itoa(w*perWriter + i)}}}
+				if _, err := store.save(req, statusFinal, "client", "", submissionMeta{}, false); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWriter {
+				subs := store.snapshot()
+				for i := range subs {
+					subs[i].Status = statusDraft
+					for j := range subs[i].Answers {
+						subs[i].Answers[j].Value = "changed"
+					}
+					subs[i].Answers = append(subs[i].Answers, Answer{QuestionID: 2, Value: "extra"})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	subs := store.snapshot()
+	if len(subs) != writers*perWriter {
+		t.Fatalf("stored %d submissions, want %d", len(subs), writers*perWriter)
+	}
+	seen := make(map[int]bool, len(subs))
+	for _, sub := range subs {
+		if seen[sub.ID] {
+			t.Fatalf("duplicate submission id %d", sub.ID)
+		}
+		seen[sub.ID] = true
+		if sub.Status != statusFinal || len(sub.Answers) != 1 || sub.Answers[0].Value == "changed" {
+			t.Fatalf("submission %d was changed through a snapshot: %+v", sub.ID, sub)
+		}
+	}
+}
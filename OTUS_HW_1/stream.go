@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// streamKeepAlive is how often an idle event stream gets a comment line, so
+// proxies don't close the connection.
+const streamKeepAlive = 30 * time.Second
+
+type submissionEvent struct {
+	ID          int       `json:"id"`
+	Status      string    `json:"status"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// streamAnswersHandler sends a server-sent event for every new submission
+// until the client disconnects or the server shuts down.
+func streamAnswersHandler(store *answerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		events, unsubscribe := store.subscribe()
+		defer unsubscribe()
+		// The server's WriteTimeout would cut the stream off; keep-alives
+		// detect dead clients instead.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			slog.Warn("answers stream: clear write deadline", "request_id", requestID(r.Context()), "error", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			slog.Error("answers stream: flush not supported", "request_id", requestID(r.Context()), "error", err)
+			return
+		}
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case sub, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(submissionEvent{ID: sub.ID, Status: sub.Status, SubmittedAt: sub.SubmittedAt})
+				if err != nil {
+					slog.Error("answers stream: encode event", "request_id", requestID(r.Context()), "error", err)
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: submission\ndata: %s\n\n", sub.ID, data); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// isEventStream reports whether the client asks for server-sent events. Such
+// responses stay open indefinitely and must be neither buffered nor timed out.
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
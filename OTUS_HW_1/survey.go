@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultSurveyID names the survey configured by -questions-file and
+// -answers-file and served at the top level of the API.
+const defaultSurveyID = "default"
+
+// surveyIDPattern restricts survey IDs to names that are safe in paths.
+var surveyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Survey bundles the questions of one survey with the store of its answers.
+// Every survey has its own locks, so a busy survey doesn't block others.
+type Survey struct {
+	ID        string
+	questions *questionSet
+	store     *answerStore
+	// uploadsDir keeps the survey's files apart from other surveys.
+	uploadsDir string
+}
+
+// loadSurveys reads every <id>.json question file in cfg.SurveysDir. When
+// cfg.SurveyAnswersDir is set, the answers of each survey are persisted to
+// <SurveyAnswersDir>/<id>.json.
+func loadSurveys(cfg config) (map[string]*Survey, error) {
+	surveys := make(map[string]*Survey)
+	dir := cfg.SurveysDir
+	if dir == "" {
+		return surveys, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read surveys dir: %w", err)
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		if !surveyIDPattern.MatchString(id) || id == defaultSurveyID {
+			return nil, fmt.Errorf("survey file %s: id must consist of letters, digits, '-' and '_' and not be %q", entry.Name(), defaultSurveyID)
+		}
+
+		qs, err := loadQuestions(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("survey %s: %w", id, err)
+		}
+		answersFile := ""
+		if cfg.SurveyAnswersDir != "" {
+			answersFile = filepath.Join(cfg.SurveyAnswersDir, id+".json")
+		}
+		store, err := newAnswerStore(answersFile, cfg.DedupWindow, cfg.IdempotencyTTL, cfg.MaxSubmissionsPerIP)
+		if err != nil {
+			return nil, fmt.Errorf("survey %s: %w", id, err)
+		}
+		surveys[id] = &Survey{ID: id, questions: qs, store: store, uploadsDir: filepath.Join(cfg.UploadsDir, id)}
+	}
+	return surveys, nil
+}
+
+// sortedSurveys returns the surveys ordered by ID.
+func sortedSurveys(surveys map[string]*Survey) []*Survey {
+	list := make([]*Survey, 0, len(surveys))
+	for _, s := range surveys {
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b *Survey) int { return strings.Compare(a.ID, b.ID) })
+	return list
+}
+
+type surveySummary struct {
+	ID          string `json:"id"`
+	Questions   int    `json:"questions"`
+	Submissions int    `json:"submissions"`
+}
+
+func listSurveysHandler(surveys map[string]*Survey) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := make([]surveySummary, 0, len(surveys))
+		for _, s := range sortedSurveys(surveys) {
+			list = append(list, surveySummary{ID: s.ID, Questions: len(s.questions.all()), Submissions: s.store.count()})
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+// surveyHandler dispatches /surveys/{surveyId}/... to the routes of that
+// survey, built once per survey by routes.
+func surveyHandler(surveys map[string]*Survey, routes func(*Survey) http.Handler) http.Handler {
+	handlers := make(map[string]http.Handler, len(surveys))
+	for id, s := range surveys {
+		handlers[id] = http.StripPrefix("/surveys/"+id, routes(s))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := handlers[r.PathValue("surveyId")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "survey not found")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxFileSize applies to file questions that don't set maxFileSize.
+const defaultMaxFileSize = 5 << 20
+
+// uploadFormField is the multipart field that carries the uploaded file.
+const uploadFormField = "file"
+
+// uploadFileHandler stores a file for a file question of an existing
+// submission. The answer value becomes the stored file name inside dir.
+func uploadFileHandler(qs *questionSet, store *answerStore, trail auditTrail, dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("submissionId"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid submission id")
+			return
+		}
+		questionID, err := strconv.Atoi(r.PathValue("questionId"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid question id")
+			return
+		}
+
+		view := qs.snapshot()
+		q, ok := view.byID[questionID]
+		if !ok {
+			writeError(w, http.StatusNotFound, "question not found")
+			return
+		}
+		if q.Type != "file" {
+			writeErrors(w, http.StatusBadRequest, []apiError{questionError(q.ID, "question does not accept files")})
+			return
+		}
+		sub, ok := store.get(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "submission not found")
+			return
+		}
+		if !isVisible(q, view.byID, answerValues(sub.Answers)) {
+			writeErrors(w, http.StatusBadRequest, []apiError{questionError(q.ID, "question does not apply to the given answers")})
+			return
+		}
+		if answerValues(sub.Answers)[q.ID] != "" {
+			writeErrors(w, http.StatusConflict, []apiError{questionError(q.ID, "file is already uploaded")})
+			return
+		}
+
+		name, status, err := receiveUpload(w, r, q, dir, fmt.Sprintf("%d-%d-", sub.ID, q.ID))
+		if err != nil {
+			if status == http.StatusInternalServerError {
+				slog.Error("upload file", "request_id", requestID(r.Context()), "error", err)
+				writeError(w, status, "failed to store file")
+				return
+			}
+			writeErrors(w, status, []apiError{questionError(q.ID, err.Error())})
+			return
+		}
+
+		answer := Answer{QuestionID: q.ID, Value: name}
+		attached, err := store.setAnswer(sub.ID, answer)
+		if err != nil || !attached {
+			os.Remove(filepath.Join(dir, name))
+			if err != nil {
+				slog.Error("attach file", "request_id", requestID(r.Context()), "error", err)
+				writeError(w, http.StatusInternalServerError, "failed to store file")
+				return
+			}
+			writeError(w, http.StatusNotFound, "submission not found")
+			return
+		}
+		slog.Info("file attached", "request_id", requestID(r.Context()), "file", name, "submission_id", sub.ID)
+		trail.record(r, auditUpload, sub.ID, []Answer{answer}, "")
+		writeJSON(w, http.StatusCreated, answer)
+	}
+}
+
+// receiveUpload reads the file part of a multipart request into dir under a
+// new name starting with prefix. Errors with a 4xx status are meant for the
+// client.
+func receiveUpload(w http.ResponseWriter, r *http.Request, q Question, dir, prefix string) (string, int, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return "", http.StatusUnsupportedMediaType, errors.New("Content-Type must be multipart/form-data")
+	}
+
+	maxSize := q.MaxFileSize
+	if maxSize == 0 {
+		maxSize = defaultMaxFileSize
+	}
+	// Leave room for the multipart framing around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+64<<10)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("invalid multipart body")
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", http.StatusBadRequest, fmt.Errorf("multipart field %q is missing", uploadFormField)
+		}
+		if err != nil {
+			return "", uploadErrorStatus(err), uploadError(err, maxSize)
+		}
+		if part.FormName() != uploadFormField || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		contentType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil || !allowedContentType(q.AllowedTypes, contentType) {
+			return "", http.StatusUnsupportedMediaType, fmt.Errorf("file type must be one of: %s", strings.Join(q.AllowedTypes, ", "))
+		}
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", http.StatusInternalServerError, fmt.Errorf("create uploads dir: %w", err)
+		}
+		name, err := uploadName(prefix, contentType)
+		if err != nil {
+			return "", http.StatusInternalServerError, err
+		}
+		tmp, err := os.CreateTemp(dir, ".upload-*")
+		if err != nil {
+			return "", http.StatusInternalServerError, fmt.Errorf("create upload file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+
+		n, err := io.Copy(tmp, io.LimitReader(part, maxSize+1))
+		if err == nil && n > maxSize {
+			err = &http.MaxBytesError{Limit: maxSize}
+		}
+		if err != nil {
+			tmp.Close()
+			return "", uploadErrorStatus(err), uploadError(err, maxSize)
+		}
+		if err := tmp.Close(); err != nil {
+			return "", http.StatusInternalServerError, fmt.Errorf("close upload file: %w", err)
+		}
+		if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+			return "", http.StatusInternalServerError, fmt.Errorf("store upload file: %w", err)
+		}
+		return name, http.StatusCreated, nil
+	}
+}
+
+func uploadErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func uploadError(err error, maxSize int64) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("file exceeds %d bytes", maxSize)
+	}
+	return errors.New("invalid multipart body")
+}
+
+// allowedContentType matches contentType against a list of MIME types, where
+// an entry like "image/*" covers a whole family.
+func allowedContentType(allowed []string, contentType string) bool {
+	for _, pattern := range allowed {
+		if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(contentType, family+"/") {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(pattern, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadName picks a fresh file name. The client's file name is not used so
+// it can't escape the uploads directory.
+func uploadName(prefix, contentType string) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("generate file name: %w", err)
+	}
+	ext := ""
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+	return prefix + hex.EncodeToString(random) + ext, nil
+}
+
+// removeUploads deletes the files referenced by the file answers of sub.
+func removeUploads(qs *questionSet, dir string, sub StoredSubmission) {
+	view := qs.snapshot()
+	for _, a := range sub.Answers {
+		if q, ok := view.byID[a.QuestionID]; !ok || q.Type != "file" || a.Value == "" {
+			continue
+		}
+		path := filepath.Join(dir, filepath.Base(a.Value))
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("remove upload", "path", path, "error", err)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// validateAnswers checks the whole request and returns every problem found,
+// or nil when the request can be stored.
+func validateAnswers(qs *questionSet, req AnswersRequest) []apiError {
+	return checkAnswers(qs, req, true)
+}
+
+// validateDraftAnswers is validateAnswers for drafts, which may leave
+// required questions unanswered.
+func validateDraftAnswers(qs *questionSet, req AnswersRequest) []apiError {
+	return checkAnswers(qs, req, false)
+}
+
+// answersSlack is how many answers beyond the number of questions a
+// submission may carry when no explicit limit is configured.
+const answersSlack = 10
+
+// checkAnswerCount rejects submissions with more than maxAnswers answers, or
+// with more than the question count plus answersSlack when maxAnswers is 0.
+// It runs before any per-answer work.
+func checkAnswerCount(qs *questionSet, answers []Answer, maxAnswers int) *apiError {
+	limit := maxAnswers
+	if limit <= 0 {
+		limit = qs.size() + answersSlack
+	}
+	if len(answers) > limit {
+		return &apiError{Message: fmt.Sprintf("a submission may contain at most %d answers", limit)}
+	}
+	return nil
+}
+
+// validateSubmission is the validation shared by POST /answers, PUT
+// /answers/{id} and POST /answers/validate: the answer count limit, then
+// normalization of req.Answers in place, then the checks for a draft or a
+// final submission.
+func validateSubmission(qs *questionSet, req AnswersRequest, draft bool, maxAnswers int) []apiError {
+	if apiErr := checkAnswerCount(qs, req.Answers, maxAnswers); apiErr != nil {
+		return []apiError{*apiErr}
+	}
+	normalizeAnswers(qs, req.Answers)
+	return checkAnswers(qs, req, !draft)
+}
+
+func checkAnswers(qs *questionSet, req AnswersRequest, enforceRequired bool) []apiError {
+	view := qs.snapshot()
+	list, byID, patterns := view.list, view.byID, view.patterns
+
+	// Answers to questions that no longer exist usually come from a stale
+	// client; report them on their own before checking values.
+	if errs := unknownQuestionErrors(byID, req); len(errs) > 0 {
+		return errs
+	}
+
+	values := answerValues(req.Answers)
+
+	var errs []apiError
+	answered := make(map[int]bool, len(req.Answers))
+	seen := make(map[int]bool, len(req.Answers))
+	for _, a := range req.Answers {
+		if seen[a.QuestionID] {
+			errs = append(errs, questionError(a.QuestionID, "duplicate answer for the same question"))
+			continue
+		}
+		seen[a.QuestionID] = true
+
+		q := byID[a.QuestionID]
+		if a.Value == "" {
+			continue
+		}
+		if !isVisible(q, byID, values) {
+			errs = append(errs, questionError(q.ID, "question does not apply to the given answers"))
+			continue
+		}
+		if err := validateValue(q, patterns[q.ID], a.Value); err != nil {
+			errs = append(errs, questionError(q.ID, err.Error()))
+			continue
+		}
+		answered[q.ID] = true
+	}
+
+	for _, q := range list {
+		// Files are uploaded after the submission is stored, so a required
+		// file question can't be enforced here.
+		if enforceRequired && isRequired(q, byID, values) && q.Type != "file" && !answered[q.ID] && !hasError(errs, q.ID) && isVisible(q, byID, values) {
+			message := "answer is required"
+			if !q.Required {
+				message = fmt.Sprintf("answer is required when question %d is %q", q.RequiredIf.QuestionID, q.RequiredIf.Value)
+			}
+			errs = append(errs, questionError(q.ID, message))
+		}
+	}
+	return errs
+}
+
+// normalizeAnswers trims text and email values and replaces select and
+// multiselect values with the options they match case-insensitively, so
+// equivalent answers are stored, counted and deduplicated the same way. It also
+// sets the JSON type each answer is written back with. Answers to unknown
+// questions are left for validation to report.
+func normalizeAnswers(qs *questionSet, answers []Answer) {
+	byID := qs.snapshot().byID
+	for i, a := range answers {
+		q, ok := byID[a.QuestionID]
+		if !ok {
+			continue
+		}
+		answers[i].kind = answerKind(q, a.kind)
+		switch q.Type {
+		case "text", "email", "url":
+			answers[i].Value = strings.TrimSpace(a.Value)
+		case "select":
+			value := strings.TrimSpace(a.Value)
+			if j := slices.IndexFunc(q.Options, func(o string) bool { return strings.EqualFold(o, value) }); j >= 0 {
+				value = q.Options[j]
+			}
+			answers[i].Value = value
+		case "multiselect":
+			chosen, err := parseMultiselect(a.Value)
+			if err != nil {
+				continue
+			}
+			for k, item := range chosen {
+				item = strings.TrimSpace(item)
+				if j := slices.IndexFunc(q.Options, func(o string) bool { return strings.EqualFold(o, item) }); j >= 0 {
+					item = q.Options[j]
+				}
+				chosen[k] = item
+			}
+			if encoded, err := json.Marshal(chosen); err == nil {
+				answers[i].Value = string(encoded)
+			}
+		}
+	}
+}
+
+// applyDefaults adds the default of every optional question that applies to
+// the answers but was left empty. Questions are visited in list order, so a
+// default can make a later conditional question apply.
+func applyDefaults(qs *questionSet, req *AnswersRequest) {
+	view := qs.snapshot()
+	values := answerValues(req.Answers)
+	for _, q := range view.list {
+		if isRequired(q, view.byID, values) || q.Default == "" || values[q.ID] != "" || !isVisible(q, view.byID, values) {
+			continue
+		}
+		req.Answers = slices.DeleteFunc(req.Answers, func(a Answer) bool { return a.QuestionID == q.ID })
+		req.Answers = append(req.Answers, Answer{QuestionID: q.ID, Value: q.Default, kind: kindFor(q)})
+		values[q.ID] = q.Default
+	}
+}
+
+// answerValues maps question IDs to the first non-empty answer value.
+func answerValues(answers []Answer) map[int]string {
+	values := make(map[int]string, len(answers))
+	for _, a := range answers {
+		if _, ok := values[a.QuestionID]; !ok && a.Value != "" {
+			values[a.QuestionID] = a.Value
+		}
+	}
+	return values
+}
+
+func unknownQuestionErrors(byID map[int]Question, req AnswersRequest) []apiError {
+	var errs []apiError
+	reported := make(map[int]bool)
+	for _, a := range req.Answers {
+		if _, ok := byID[a.QuestionID]; !ok && !reported[a.QuestionID] {
+			reported[a.QuestionID] = true
+			errs = append(errs, questionError(a.QuestionID, "unknown question"))
+		}
+	}
+	return errs
+}
+
+// isVisible reports whether the showIf chain of q is satisfied by values.
+// Chains are checked for cycles when questions are loaded.
+// A condition on a multiselect question holds when Value is among the chosen
+// options.
+func isVisible(q Question, byID map[int]Question, values map[int]string) bool {
+	for q.ShowIf != nil {
+		if !conditionMet(*q.ShowIf, byID, values) {
+			return false
+		}
+		q = byID[q.ShowIf.QuestionID]
+	}
+	return true
+}
+
+// conditionMet reports whether the answer to the question cond refers to has
+// cond.Value, or for a multiselect question includes it.
+func conditionMet(cond Condition, byID map[int]Question, values map[int]string) bool {
+	value := values[cond.QuestionID]
+	if byID[cond.QuestionID].Type == "multiselect" {
+		chosen, err := parseMultiselect(value)
+		return err == nil && slices.Contains(chosen, cond.Value)
+	}
+	return value == cond.Value
+}
+
+// isRequired reports whether q must be answered given the other answers:
+// always when Required is set, otherwise while its requiredIf holds.
+func isRequired(q Question, byID map[int]Question, values map[int]string) bool {
+	return q.Required || (q.RequiredIf != nil && conditionMet(*q.RequiredIf, byID, values))
+}
+
+// parseMultiselect decodes a multiselect answer, which is stored as a JSON
+// array of the chosen options, e.g. ["Go","Rust"].
+func parseMultiselect(value string) ([]string, error) {
+	var chosen []string
+	if err := json.Unmarshal([]byte(value), &chosen); err != nil {
+		return nil, errors.New(`expected a JSON array of options, e.g. ["a","b"]`)
+	}
+	return chosen, nil
+}
+
+// allowedHost reports whether host is one of allowed. A "*.example.com" entry
+// allows any subdomain of example.com, but not example.com itself.
+func allowedHost(allowed []string, host string) bool {
+	for _, pattern := range allowed {
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if len(host) > len(domain)+1 && strings.EqualFold(host[len(host)-len(domain)-1:], "."+domain) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateValue(q Question, pattern *regexp.Regexp, value string) error {
+	switch q.Type {
+	case "text":
+		return validateRules(q, pattern, value)
+	case "file":
+		return errors.New("files must be uploaded to POST /answers/{submissionId}/files/{questionId}")
+	case "number":
+		n, err := strconv.ParseFloat(value, 64)
+		// ParseFloat accepts NaN and Inf, which no bound can reject.
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return errors.New("expected a number")
+		}
+		if q.Integer && n != math.Trunc(n) {
+			return errors.New("expected a whole number")
+		}
+		if q.Min != nil && n < *q.Min {
+			return fmt.Errorf("value must be at least %g", *q.Min)
+		}
+		if q.Max != nil && n > *q.Max {
+			return fmt.Errorf("value must be at most %g", *q.Max)
+		}
+	case "rating":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("expected an integer rating")
+		}
+		if float64(n) < *q.Min || float64(n) > *q.Max {
+			return fmt.Errorf("rating must be between %g and %g", *q.Min, *q.Max)
+		}
+	case "url":
+		u, err := url.ParseRequestURI(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("expected an absolute http or https URL")
+		}
+		if len(q.AllowedHosts) > 0 && !allowedHost(q.AllowedHosts, u.Hostname()) {
+			return fmt.Errorf("link must point to one of: %s", strings.Join(q.AllowedHosts, ", "))
+		}
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return errors.New("expected a valid email address")
+		}
+		return validateRules(q, pattern, value)
+	case "date":
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			return fmt.Errorf("expected a date in the %s format", dateLayout)
+		}
+		// Dates in the YYYY-MM-DD layout sort the same way as strings.
+		if q.MinDate != "" && value < q.MinDate {
+			return fmt.Errorf("date must not be before %s", q.MinDate)
+		}
+		if q.MaxDate != "" && value > q.MaxDate {
+			return fmt.Errorf("date must not be after %s", q.MaxDate)
+		}
+	case "select":
+		if !slices.Contains(q.Options, value) {
+			return fmt.Errorf("value %q is not one of the allowed options", value)
+		}
+	case "multiselect":
+		chosen, err := parseMultiselect(value)
+		if err != nil {
+			return err
+		}
+		if len(chosen) == 0 {
+			return errors.New("choose at least one option")
+		}
+		for i, item := range chosen {
+			if !slices.Contains(q.Options, item) {
+				return fmt.Errorf("value %q is not one of the allowed options", item)
+			}
+			if slices.Contains(chosen[:i], item) {
+				return fmt.Errorf("option %q is chosen more than once", item)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRules(q Question, pattern *regexp.Regexp, value string) error {
+	if q.MaxLength > 0 && utf8.RuneCountInString(value) > q.MaxLength {
+		return fmt.Errorf("value must be at most %d characters long", q.MaxLength)
+	}
+	if q.Validation == nil {
+		return nil
+	}
+	if q.Validation.MinLength > 0 && utf8.RuneCountInString(value) < q.Validation.MinLength {
+		return fmt.Errorf("value must be at least %d characters long", q.Validation.MinLength)
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return errors.New("value does not match the required format")
+	}
+	return nil
+}
+
+func hasError(errs []apiError, questionID int) bool {
+	for _, e := range errs {
+		if e.QuestionID != nil && *e.QuestionID == questionID {
+			return true
+		}
+	}
+	return false
+}
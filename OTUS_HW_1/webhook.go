@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const webhookTimeout = 5 * time.Second
+
+// webhookNotifier posts new submissions to an external URL. A nil notifier
+// does nothing, so callers don't need to check whether webhooks are enabled.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookNotifier(url string) *webhookNotifier {
+	if url == "" {
+		return nil
+	}
+	return &webhookNotifier{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// notify delivers sub in the background. Failures are logged and not retried.
+func (n *webhookNotifier) notify(sub StoredSubmission) {
+	if n == nil {
+		return
+	}
+	go func() {
+		if err := n.send(sub); err != nil {
+			slog.Error("webhook", "submission_id", sub.ID, "error", err)
+			return
+		}
+		slog.Debug("webhook delivered", "submission_id", sub.ID)
+	}()
+}
+
+// send posts sub without its draft and upload tokens: they authorize changes
+// to the submission and must stay with the respondent.
+func (n *webhookNotifier) send(sub StoredSubmission) error {
+	sub.DraftToken = ""
+	sub.UploadToken = ""
+	body, err := json.Marshal(sub)
+	if err != nil {
+		return fmt.Errorf("encode submission: %w", err)
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWebhookOmitsTokens checks that the draft and upload tokens, which let
+// the respondent change a submission, are not sent to the webhook.
+func TestWebhookOmitsTokens(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		body = string(b)
+	}))
+	defer srv.Close()
+
+	sub := StoredSubmission{ID: 1, Status: statusDraft, DraftToken: "draft-secret", UploadToken: "upload-secret"}
+	if err := newWebhookNotifier(srv.URL).send(sub); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(body, "secret") || strings.Contains(body, "Token") {
+		t.Fatalf("webhook body contains a token: %s", body)
+	}
+	if !strings.Contains(body, `"id":1`) {
+		t.Fatalf("webhook body = %s, want the submission", body)
+	}
+}